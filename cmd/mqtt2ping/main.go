@@ -9,84 +9,354 @@ import (
 	"github.com/antigloss/go/logger"
 	"github.com/flavio-fernandes/mqtt2ping/internal/manager"
 	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+	"gopkg.in/yaml.v3"
 )
 
 const (
 	DefaultLogDir = "/tmp/mqtt2ping_log"
 )
 
-func getMqttConfig() (mqttConfig *mqtt_agent.Config) {
-	mqttConfig = &mqtt_agent.Config{
-		ClientId:    mqtt_agent.DefMqttClientId,
-		BrokerUrl:   mqtt_agent.DefBrokerURL,
-		User:        mqtt_agent.DefBrokerUser,
-		Pass:        mqtt_agent.DefBrokerPass,
-		TopicPrefix: mqtt_agent.DefTopicPrefix,
+// getenvOrFile returns the value of the environment variable, or the content of the
+// file named by its _FILE variant, such as a mounted secret, which takes precedence
+func getenvOrFile(name string) string {
+	if filename := os.Getenv(name + "_FILE"); filename != "" {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprint(os.Stderr, fmt.Sprint("Unable to read ", name, "_FILE: ", err, "\n"))
+			os.Exit(1)
+		}
+		return strings.TrimRight(string(data), "\r\n")
 	}
+	return os.Getenv(name)
+}
 
+// defaultSettings are the settings used when not set by the config file, env or flags
+func defaultSettings() *manager.Settings {
+	verbose := false
+	return &manager.Settings{
+		Mqtt: manager.MqttSettings{
+			ClientId:    mqtt_agent.DefMqttClientId,
+			BrokerUrl:   mqtt_agent.DefBrokerURL,
+			User:        mqtt_agent.DefBrokerUser,
+			Pass:        mqtt_agent.DefBrokerPass,
+			TopicPrefix: mqtt_agent.DefTopicPrefix,
+		},
+		Logging: manager.LoggingSettings{
+			Dir:     DefaultLogDir,
+			Verbose: &verbose,
+		},
+	}
+}
+
+// applyFileSettings overrides the settings with the ones set in the config file
+func applyFileSettings(settings, fileSettings *manager.Settings) {
+	override := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	override(&settings.Mqtt.ClientId, fileSettings.Mqtt.ClientId)
+	override(&settings.Mqtt.BrokerUrl, fileSettings.Mqtt.BrokerUrl)
+	override(&settings.Mqtt.User, fileSettings.Mqtt.User)
+	override(&settings.Mqtt.Pass, fileSettings.Mqtt.Pass)
+	override(&settings.Mqtt.TopicPrefix, fileSettings.Mqtt.TopicPrefix)
+	override(&settings.Logging.Dir, fileSettings.Logging.Dir)
+	if fileSettings.Logging.Verbose != nil {
+		settings.Logging.Verbose = fileSettings.Logging.Verbose
+	}
+}
+
+// applyEnvSettings overrides the settings with the ones set in the environment
+func applyEnvSettings(settings *manager.Settings) {
 	var paramValue string
 	if paramValue = os.Getenv("CLIENTID"); paramValue != "" {
-		mqttConfig.ClientId = paramValue
+		settings.Mqtt.ClientId = paramValue
 	}
-	if paramValue = os.Getenv("BROKERURL"); paramValue != "" {
-		mqttConfig.BrokerUrl = paramValue
+	if paramValue = getenvOrFile("BROKERURL"); paramValue != "" {
+		settings.Mqtt.BrokerUrl = paramValue
 	}
-	if paramValue = os.Getenv("MQTTUSER"); paramValue != "" {
-		mqttConfig.User = paramValue
+	if paramValue = getenvOrFile("MQTTUSER"); paramValue != "" {
+		settings.Mqtt.User = paramValue
 	}
-	if paramValue = os.Getenv("MQTTPASS"); paramValue != "" {
-		mqttConfig.Pass = paramValue
+	if paramValue = getenvOrFile("MQTTPASS"); paramValue != "" {
+		settings.Mqtt.Pass = paramValue
 	}
 	if paramValue = os.Getenv("PREFIX"); paramValue != "" {
-		mqttConfig.TopicPrefix = paramValue
+		settings.Mqtt.TopicPrefix = paramValue
+	}
+	if paramValue = os.Getenv("LOGDIR"); paramValue != "" {
+		settings.Logging.Dir = paramValue
+	}
+	if paramValue = os.Getenv("DEBUG"); paramValue != "" {
+		verbose := paramValue == "1"
+		settings.Logging.Verbose = &verbose
 	}
-	return
 }
 
-func main() {
-	verbose := os.Getenv("DEBUG") == "1"
-	defaultLogDir := os.Getenv("LOGDIR")
-	if defaultLogDir == "" {
-		defaultLogDir = DefaultLogDir
+func getMqttConfig(settings *manager.MqttSettings) *mqtt_agent.Config {
+	return &mqtt_agent.Config{
+		ClientId:    settings.ClientId,
+		BrokerUrl:   settings.BrokerUrl,
+		User:        settings.User,
+		Pass:        settings.Pass,
+		TopicPrefix: settings.TopicPrefix,
 	}
-	configFilename := os.Getenv("CONFIG")
-	mqttConfig := getMqttConfig()
-
-	verboseParamPtr := flag.Bool("verbose", verbose, "enable trace level logs. Can be enabled by setting env DEBUG=1")
-	logDirParamPtr := flag.String("logdir", defaultLogDir, "logs directory. Use env LOGDIR to override")
-	configParamPtr := flag.String("config", configFilename, "application config yaml file. Use env CONFIG to override")
-	clientIdParamPtr := flag.String("client", mqttConfig.ClientId, "mqtt client id. Use env CLIENTID to override. To auto-generate, use 'random'")
-	brokerUrlParamPtr := flag.String("broker", mqttConfig.BrokerUrl, "mqtt broker url. Use env BROKERURL to override")
-	userParamPtr := flag.String("user", mqttConfig.User, "mqtt username. Use env MQTTUSER to override")
-	passParamPtr := flag.String("pass", mqttConfig.Pass, "mqtt password. Use env MQTTPASS to override")
-	topicPrefixParamPtr := flag.String("topic", mqttConfig.TopicPrefix, "mqtt topic pinger prefix. Use env PREFIX to override")
-	flag.Parse()
+}
 
-	// https://github.com/antigloss/go/blob/92623f0632a424d1c22e37dc039a05f16abe58d6/logger/logger.go#L85
-	loggerConfig := logger.Config{
-		LogDir:          *logDirParamPtr,
+// printConfig prints the effective configuration as yaml, with secrets redacted
+func printConfig(settings *manager.Settings, managerConfig *manager.Config) {
+	effective := struct {
+		Config  string                  `yaml:"config"`
+		Persist string                  `yaml:"persist"`
+		State   string                  `yaml:"state"`
+		Retain  bool                    `yaml:"retain"`
+		Watch   bool                    `yaml:"watch"`
+		Mqtt    manager.MqttSettings    `yaml:"mqtt"`
+		Logging manager.LoggingSettings `yaml:"logging"`
+	}{
+		Config:  managerConfig.Filename,
+		Persist: managerConfig.PersistFilename,
+		State:   managerConfig.StateFilename,
+		Retain:  managerConfig.Retain,
+		Watch:   managerConfig.WatchConfig,
+		Mqtt:    settings.Mqtt.Redacted(),
+		Logging: settings.Logging,
+	}
+	data, err := yaml.Marshal(&effective)
+	if err != nil {
+		fmt.Fprint(os.Stderr, fmt.Sprint("Unable to print config: ", err, "\n"))
+		os.Exit(1)
+	}
+	fmt.Print(string(data))
+}
+
+// validate is the validate subcommand: it checks config files and exits non-zero
+// if any has problems
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s validate [config.yaml ...]\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Checks the config files, or the one in env CONFIG\n")
+	}
+	_ = flags.Parse(args)
+	configFilenames := flags.Args()
+	if len(configFilenames) == 0 && os.Getenv("CONFIG") != "" {
+		configFilenames = []string{os.Getenv("CONFIG")}
+	}
+	if len(configFilenames) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	exitCode := 0
+	for _, configFilename := range configFilenames {
+		problems, err := manager.ValidateConfig(configFilename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%s: ok\n", configFilename)
+	}
+	return exitCode
+}
+
+// https://github.com/antigloss/go/blob/92623f0632a424d1c22e37dc039a05f16abe58d6/logger/logger.go#L85
+func newLoggerConfig(logDir string, logDest logger.LogDest) *logger.Config {
+	return &logger.Config{
+		LogDir:          logDir,
 		LogFileMaxSize:  4,
 		LogFileMaxNum:   20,
 		LogFileNumToDel: 5,
 		LogLevel:        logger.LogLevelInfo,
-		LogDest:         logger.LogDestBoth,
+		LogDest:         logDest,
 		Flag:            logger.ControlFlagLogThrough | logger.ControlFlagLogLineNum | logger.ControlFlagLogDate,
 	}
-	if *verboseParamPtr {
+}
+
+// snapshotFlags adds the flags for the files used by the export and import
+// subcommands, and sets up logging for them. Logs only go to files, so they
+// do not mix with the snapshot on stdout.
+func snapshotFlags(flags *flag.FlagSet) *manager.Config {
+	config := &manager.Config{}
+	flags.StringVar(&config.Filename, "config", os.Getenv("CONFIG"), "application config yaml file, or directory of them. Use env CONFIG to override")
+	flags.StringVar(&config.PersistFilename, "persist", os.Getenv("PERSIST"), "file of the destinations added via mqtt. Use env PERSIST to override")
+	flags.StringVar(&config.StateFilename, "state", os.Getenv("STATE"), "file of the state and counters of destinations. Use env STATE to override")
+
+	logDir := os.Getenv("LOGDIR")
+	if logDir == "" {
+		logDir = DefaultLogDir
+	}
+	if err := logger.Init(newLoggerConfig(logDir, logger.LogDestFile)); err != nil {
+		fmt.Fprint(os.Stderr, fmt.Sprint("Logger init failed ", logDir, " ", err, "\n"))
+		os.Exit(1)
+	}
+	return config
+}
+
+// export is the export subcommand: it prints the destinations of the config and
+// persisted files as a snapshot, to import on another instance
+func export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export [flags]\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Exports the destinations of the config and persisted files\n")
+		flags.PrintDefaults()
+	}
+	config := snapshotFlags(flags)
+	withState := flags.Bool("with-state", false, "include the state and counters saved in the state file")
+	asYaml := flags.Bool("yaml", false, "export as yaml instead of json. Implied by an output file ending with .yaml or .yml")
+	output := flags.String("o", "", "file to write the snapshot to, instead of stdout")
+	_ = flags.Parse(args)
+
+	data, err := manager.ExportSnapshot(config, *withState, *asYaml || manager.IsYamlFile(*output))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *output == "" {
+		fmt.Println(strings.TrimRight(string(data), "\n"))
+		return 0
+	}
+	if err = os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// restore is the import subcommand: it adds the destinations of a snapshot to the
+// persisted ones, and their state to the state file, for the next start
+func restore(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s import [flags] snapshot.(json|yaml)\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Adds the destinations of a snapshot to the persisted ones, loaded on the next start\n")
+		flags.PrintDefaults()
+	}
+	config := snapshotFlags(flags)
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	count, skippedStates, err := manager.ImportSnapshot(config, data, manager.IsYamlFile(flags.Arg(0)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Imported %d destinations into %s\n", count, config.PersistFilename)
+	if skippedStates > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped the state of %d destinations: no -state file to import it into\n", skippedStates)
+	}
+	return 0
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validate(os.Args[2:]))
+		case "export":
+			os.Exit(export(os.Args[2:]))
+		case "import":
+			os.Exit(restore(os.Args[2:]))
+		}
+	}
+
+	configFilename := os.Getenv("CONFIG")
+	persistFilename := os.Getenv("PERSIST")
+	stateFilename := os.Getenv("STATE")
+	retain := os.Getenv("RETAIN") == "1"
+	watchConfig := os.Getenv("WATCH") == "1"
+	defaults := defaultSettings()
+
+	// Settings are layered: defaults < config file < env < flags. The flags only
+	// apply when given, so their defaults here are just for the usage.
+	verboseParamPtr := flag.Bool("verbose", *defaults.Logging.Verbose, "enable trace level logs. Can be enabled by setting env DEBUG=1 or logging.verbose in the config")
+	logDirParamPtr := flag.String("logdir", defaults.Logging.Dir, "logs directory. Use env LOGDIR or logging.dir in the config to override")
+	configParamPtr := flag.String("config", configFilename, "application config yaml file, or directory of them. Use env CONFIG to override")
+	persistParamPtr := flag.String("persist", persistFilename, "file where destinations added via mqtt are saved and loaded at startup (.yaml/.yml for yaml, json otherwise). Use env PERSIST to override")
+	stateParamPtr := flag.String("state", stateFilename, "file where the state and counters of destinations are saved and restored at startup. Use env STATE to override")
+	retainParamPtr := flag.Bool("retain", retain, "publish state and info retained, and restore the last state from them at startup. Can be enabled by setting env RETAIN=1")
+	watchParamPtr := flag.Bool("watch", watchConfig, "reload the config yaml when its file changes. It is always reloaded on SIGHUP. Can be enabled by setting env WATCH=1")
+	printConfigParamPtr := flag.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	clientIdParamPtr := flag.String("client", defaults.Mqtt.ClientId, "mqtt client id. Use env CLIENTID or mqtt.client in the config to override. To auto-generate, use 'random'")
+	brokerUrlParamPtr := flag.String("broker", defaults.Mqtt.BrokerUrl, "mqtt broker url. Use env BROKERURL, BROKERURL_FILE or mqtt.broker in the config to override")
+	userParamPtr := flag.String("user", defaults.Mqtt.User, "mqtt username. Use env MQTTUSER, MQTTUSER_FILE or mqtt.user in the config to override")
+	passParamPtr := flag.String("pass", defaults.Mqtt.Pass, "mqtt password. Use env MQTTPASS, MQTTPASS_FILE or mqtt.pass in the config to override")
+	topicPrefixParamPtr := flag.String("topic", defaults.Mqtt.TopicPrefix, "mqtt topic pinger prefix. Use env PREFIX or mqtt.topic in the config to override")
+	flag.Parse()
+
+	settings := defaults
+	if *configParamPtr != "" {
+		fileSettings, err := manager.ReadSettings(*configParamPtr)
+		if err != nil {
+			fmt.Fprint(os.Stderr, fmt.Sprint("Config init failed: ", err, "\n"))
+			os.Exit(2)
+		}
+		applyFileSettings(settings, fileSettings)
+	}
+	applyEnvSettings(settings)
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "verbose":
+			settings.Logging.Verbose = verboseParamPtr
+		case "logdir":
+			settings.Logging.Dir = *logDirParamPtr
+		case "client":
+			settings.Mqtt.ClientId = *clientIdParamPtr
+		case "broker":
+			settings.Mqtt.BrokerUrl = *brokerUrlParamPtr
+		case "user":
+			settings.Mqtt.User = *userParamPtr
+		case "pass":
+			settings.Mqtt.Pass = *passParamPtr
+		case "topic":
+			settings.Mqtt.TopicPrefix = *topicPrefixParamPtr
+		}
+	})
+
+	managerConfig := &manager.Config{
+		Filename:        *configParamPtr,
+		PersistFilename: *persistParamPtr,
+		StateFilename:   *stateParamPtr,
+		Retain:          *retainParamPtr,
+		WatchConfig:     *watchParamPtr,
+		Subscribed:      mqtt_agent.Subscribed(),
+		StopRetained:    mqtt_agent.StopReadingRetained,
+	}
+	if *printConfigParamPtr {
+		printConfig(settings, managerConfig)
+		return
+	}
+
+	loggerConfig := newLoggerConfig(settings.Logging.Dir, logger.LogDestBoth)
+	if *settings.Logging.Verbose {
 		loggerConfig.LogLevel = logger.LogLevelTrace
 	}
-	err := logger.Init(&loggerConfig)
+	err := logger.Init(loggerConfig)
 	if err != nil {
-		fmt.Fprint(os.Stderr, fmt.Sprint("Logger init failed ", *logDirParamPtr, " ", err, "\n"))
+		fmt.Fprint(os.Stderr, fmt.Sprint("Logger init failed ", settings.Logging.Dir, " ", err, "\n"))
 		os.Exit(1)
 	}
 	logger.Infof("starting main application. config yaml: %s", *configParamPtr)
 
-	mqttConfig.ClientId = *clientIdParamPtr
-	mqttConfig.BrokerUrl = *brokerUrlParamPtr
-	mqttConfig.User = *userParamPtr
-	mqttConfig.Pass = *passParamPtr
-	mqttConfig.TopicPrefix = *topicPrefixParamPtr
+	mqttConfig := getMqttConfig(&settings.Mqtt)
+	mqttConfig.Retain = *retainParamPtr
 
 	// Empty mqttConfig.ClientId to make client auto generate one
 	if strings.EqualFold(mqttConfig.ClientId, "random") || mqttConfig.ClientId == "" {
@@ -96,7 +366,7 @@ func main() {
 
 	mqttSubMsgChannel := make(chan mqtt_agent.Msg, 1024)
 	mqttPubMsgChannel := mqtt_agent.Start(mqttConfig, mqttSubMsgChannel)
-	mgr, err := manager.Start(mqttPubMsgChannel, mqttSubMsgChannel, *configParamPtr)
+	mgr, err := manager.Start(mqttPubMsgChannel, mqttSubMsgChannel, managerConfig)
 	if err != nil {
 		fmt.Fprint(os.Stderr, fmt.Sprint("Main init failed: ", err, "\n"))
 		os.Exit(2)
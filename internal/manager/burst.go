@@ -0,0 +1,168 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+	"github.com/go-ping/ping"
+)
+
+const (
+	defaultBurstCount           = 5
+	maxBurstCount               = 100
+	defaultBurstIntervalSeconds = 1.0
+	minBurstIntervalSeconds     = 0.1
+
+	// maxConcurrentBursts limits how many on-demand pings run at the same time
+	maxConcurrentBursts = 8
+)
+
+// burstRequestJson is the payload of a ping request. A plain address is also accepted.
+type burstRequestJson struct {
+	Address  string
+	Count    int
+	Size     int
+	Interval float64 // seconds
+	Timeout  float64 // seconds
+}
+
+// burstResultJson is what gets published on the result topic of a ping request
+type burstResultJson struct {
+	Id              string    `json:"id"`
+	Address         string    `json:"address"`
+	Ip              string    `json:"ip,omitempty"`
+	PacketsSent     int       `json:"packets_sent"`
+	PacketsReceived int       `json:"packets_received"`
+	PacketLoss      float64   `json:"packets_loss_percent"`
+	Rtts            []float64 `json:"rtts_in_milliseconds"`
+	MinRtt          float64   `json:"min_rtt_in_milliseconds"`
+	AvgRtt          float64   `json:"avg_rtt_in_milliseconds"`
+	MaxRtt          float64   `json:"max_rtt_in_milliseconds"`
+	StdDevRtt       float64   `json:"stddev_rtt_in_milliseconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+func parseBurstRequest(payload string) (burstRequestJson, error) {
+	var req burstRequestJson
+	payload = strings.TrimSpace(payload)
+	if json.Valid([]byte(payload)) && strings.HasPrefix(payload, "{") {
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			return req, fmt.Errorf("invalid json: %w", err)
+		}
+	} else {
+		req.Address = payload
+	}
+
+	if req.Address == "" {
+		return req, fmt.Errorf("no address")
+	}
+	if req.Count == 0 {
+		req.Count = defaultBurstCount
+	}
+	if req.Count < 0 || req.Count > maxBurstCount {
+		return req, fmt.Errorf("count %d is not between 1 and %d", req.Count, maxBurstCount)
+	}
+	if req.Interval == 0 {
+		req.Interval = defaultBurstIntervalSeconds
+	}
+	if req.Interval < minBurstIntervalSeconds {
+		return req, fmt.Errorf("interval %v is less than %v seconds", req.Interval, minBurstIntervalSeconds)
+	}
+	if req.Size < 0 {
+		return req, fmt.Errorf("invalid size %d", req.Size)
+	}
+	if req.Timeout <= 0 {
+		req.Timeout = float64(req.Count)*req.Interval + 5
+	}
+	return req, nil
+}
+
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// runBurst pings the address of the request and blocks until it is done
+func runBurst(id string, req burstRequestJson) burstResultJson {
+	result := burstResultJson{Id: id, Address: req.Address, Rtts: []float64{}}
+
+	pinger, err := ping.NewPinger(req.Address)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	pinger.Count = req.Count
+	pinger.Interval = time.Duration(req.Interval * float64(time.Second))
+	pinger.Timeout = time.Duration(req.Timeout * float64(time.Second))
+	if req.Size > 0 {
+		pinger.Size = req.Size
+	}
+	if err = pinger.Run(); err != nil {
+		result.Error = err.Error()
+	}
+
+	stats := pinger.Statistics()
+	result.Ip = pinger.IPAddr().String()
+	result.PacketsSent = stats.PacketsSent
+	result.PacketsReceived = stats.PacketsRecv
+	if stats.PacketsSent > 0 {
+		result.PacketLoss = stats.PacketLoss
+	}
+	for _, rtt := range stats.Rtts {
+		result.Rtts = append(result.Rtts, toMilliseconds(rtt))
+	}
+	result.MinRtt = toMilliseconds(stats.MinRtt)
+	result.AvgRtt = toMilliseconds(stats.AvgRtt)
+	result.MaxRtt = toMilliseconds(stats.MaxRtt)
+	result.StdDevRtt = toMilliseconds(stats.StdDevRtt)
+	return result
+}
+
+// msgParsePing runs an on-demand ping in the background, so the main loop is not
+// blocked, and publishes its result on the result topic of the request
+func (m *Manager) msgParsePing(topic, payload string) {
+	id, ok := mqtt_agent.GetTopicSubPingId(topic)
+	if !ok {
+		logger.Tracef("Ignoring ping topic that is not a request: %s", topic)
+		return
+	}
+	if payload == "" {
+		// likely the removal of a retained request
+		return
+	}
+
+	req, err := parseBurstRequest(payload)
+	if err != nil {
+		logger.Warnf("Ignoring ping request %s: %v", id, err)
+		m.publishBurstResult(burstResultJson{Id: id, Address: req.Address, Rtts: []float64{}, Error: err.Error()})
+		return
+	}
+
+	select {
+	case m.burstSlots <- struct{}{}:
+	default:
+		logger.Warnf("Ignoring ping request %s: too many requests in progress", id)
+		m.publishBurstResult(burstResultJson{Id: id, Address: req.Address, Rtts: []float64{}, Error: "too many requests in progress"})
+		return
+	}
+
+	logger.Infof("Ping request %s: %d packets to %s", id, req.Count, req.Address)
+	go func() {
+		defer func() { <-m.burstSlots }()
+		m.publishBurstResult(runBurst(id, req))
+	}()
+}
+
+func (m *Manager) publishBurstResult(result burstResultJson) {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("Unable to encode ping result %s: %v", result.Id, err)
+		return
+	}
+	msg := mqtt_agent.Msg{}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubPingResult(result.Id, string(payload))
+	m.mqttPub <- msg
+}
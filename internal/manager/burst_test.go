@@ -0,0 +1,24 @@
+package manager
+
+import "testing"
+
+func TestParseBurstRequest(t *testing.T) {
+	req, err := parseBurstRequest("192.168.1.1")
+	if err != nil || req.Address != "192.168.1.1" || req.Count != defaultBurstCount || req.Interval != defaultBurstIntervalSeconds {
+		t.Fatalf("unexpected request %+v: %v", req, err)
+	}
+	if req.Timeout != float64(defaultBurstCount)*defaultBurstIntervalSeconds+5 {
+		t.Fatalf("unexpected default timeout %v", req.Timeout)
+	}
+
+	req, err = parseBurstRequest(`{"address": "::1", "count": 10, "size": 64, "interval": 0.2, "timeout": 3}`)
+	if err != nil || req.Address != "::1" || req.Count != 10 || req.Size != 64 || req.Interval != 0.2 || req.Timeout != 3 {
+		t.Fatalf("unexpected request %+v: %v", req, err)
+	}
+
+	for _, payload := range []string{"", `{"count": 3}`, `{"address": "a", "count": 1000}`, `{"address": "a", "interval": 0.01}`} {
+		if _, err = parseBurstRequest(payload); err == nil {
+			t.Fatalf("expected error parsing %q", payload)
+		}
+	}
+}
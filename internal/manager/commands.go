@@ -0,0 +1,183 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+const (
+	commandPause  = "pause"
+	commandResume = "resume"
+	commandReset  = "reset"
+	commandRename = "rename"
+)
+
+// commandJson is the payload of the command topic. The action alone, as plain
+// text, is also accepted.
+type commandJson struct {
+	Action string
+	To     string // new name, for rename
+}
+
+func parseCommand(payload string) (commandJson, error) {
+	var cmd commandJson
+	payload = strings.TrimSpace(payload)
+	if strings.HasPrefix(payload, "{") {
+		if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
+			return cmd, fmt.Errorf("invalid json: %w", err)
+		}
+	} else {
+		cmd.Action = payload
+	}
+	cmd.Action = strings.ToLower(cmd.Action)
+	if cmd.Action == "" {
+		return cmd, fmt.Errorf("no action")
+	}
+	return cmd, nil
+}
+
+func (m *Manager) msgParseCommand(topic, payload string) {
+	name, ok := mqtt_agent.GetTopicSubDestinationCommand(topic)
+	if !ok {
+		logger.Errorf("Unexpected parsing of topic: %s", topic)
+		return
+	}
+	if payload == "" {
+		// likely the removal of a retained command
+		return
+	}
+	cmd, err := parseCommand(payload)
+	if err != nil {
+		logger.Warnf("Ignoring command for destination %s: %v", name, err)
+		m.publishResult(name, "command", payload, err)
+		return
+	}
+	destination, ok := m.destinationMap[name]
+	if !ok {
+		logger.Warnf("Ignoring command for destination %s: not-found", name)
+		m.publishResult(name, cmd.Action, payload, errNotFound)
+		return
+	}
+
+	switch cmd.Action {
+	case commandPause:
+		m.pauseCommand(destination)
+	case commandResume:
+		m.resumeCommand(destination)
+	case commandReset:
+		m.resetDestination(destination)
+	case commandRename:
+		if err = m.renameDestination(destination, cmd.To); err != nil {
+			logger.Warnf("Ignoring rename of destination %s: %v", name, err)
+		}
+	default:
+		err = fmt.Errorf("unknown action %q", cmd.Action)
+		logger.Warnf("Ignoring command for destination %s: %v", name, err)
+	}
+	m.publishResult(name, cmd.Action, payload, err)
+}
+
+func (m *Manager) pauseCommand(destination *Destination) {
+	if destination.paused {
+		logger.Infof("%s is already paused", destination.Name)
+		return
+	}
+	wasProbing := destination.isProbing()
+	destination.paused = true
+	m.updateProbing(destination, wasProbing)
+}
+
+func (m *Manager) resumeCommand(destination *Destination) {
+	if !destination.paused {
+		logger.Infof("%s is not paused", destination.Name)
+		return
+	}
+	wasProbing := destination.isProbing()
+	destination.paused = false
+	m.updateProbing(destination, wasProbing)
+}
+
+// resetDestination zeroes the counters of the destination. Its pingers are
+// restarted, so their loss and round trip statistics start over as well.
+func (m *Manager) resetDestination(destination *Destination) {
+	destination.packetsSent = 0
+	destination.packetsRecv = 0
+	destination.consecutiveOfflines = 0
+	destination.statsSamples = nil
+	if destination.isProbing() {
+		destination.stopProbe()
+		if err := destination.startProbe(destination.targetAddrs); err != nil {
+			logger.Errorf("Unable to restart pinger for destination %s: %v", destination.Name, err)
+		}
+	}
+	logger.Infof("Reset counters of destination %s", destination.Name)
+	m.publishDestination(destination)
+}
+
+// renameDestination moves the destination to a new name, keeping its pingers,
+// counters and state. Its config is published retained under the new name and
+// the retained topics of the old name are cleared. Only
+// destinations added via mqtt can be renamed: the others would be brought back
+// under their old name by the next reload of their config or source.
+func (m *Manager) renameDestination(destination *Destination, newName string) error {
+	oldName := destination.Name
+	switch {
+	case destination.source != sourceMqtt:
+		return fmt.Errorf("only destinations added via mqtt can be renamed, not from %s", destination.source)
+	case newName == "":
+		return fmt.Errorf("no new name")
+	case strings.ContainsAny(newName, "/+#"):
+		return fmt.Errorf("invalid name %q", newName)
+	case newName == oldName:
+		return nil
+	}
+	if _, ok := m.destinationMap[newName]; ok {
+		return fmt.Errorf("%w: %s", errDuplicate, newName)
+	}
+	config, err := json.Marshal(destination.toJson())
+	if err != nil {
+		return fmt.Errorf("unable to encode destination: %w", err)
+	}
+
+	delete(m.destinationMap, oldName)
+	destination.Name = newName
+	m.destinationMap[newName] = destination
+	for _, other := range m.destinationMap {
+		for i, parent := range other.DependsOn {
+			if parent == oldName {
+				other.DependsOn[i] = newName
+			}
+		}
+	}
+
+	// a retained destination topic adds the destination back after a restart, so
+	// move it to the new name
+	m.publishDestinationConfig(newName, string(config))
+	m.publishDestinationConfig(oldName, "")
+	m.clearDestinationTopics(oldName)
+	logger.Infof("Renamed destination %s to %s", oldName, newName)
+	m.publishDestination(destination)
+	return nil
+}
+
+// publishDestinationConfig publishes on the topic destinations are added on,
+// retained. Its echo is ignored, since it is already applied.
+func (m *Manager) publishDestinationConfig(name, payload string) {
+	m.ownDestinationMsgs[name] = payload
+	msg := mqtt_agent.Msg{Retained: true}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubDestinationConfig(name, payload)
+	m.mqttPub <- msg
+}
+
+// clearDestinationTopics removes the retained messages of a destination name
+func (m *Manager) clearDestinationTopics(name string) {
+	msg := mqtt_agent.Msg{Retained: true}
+	msg.Topic, _ = mqtt_agent.MsgPubAdvStateValue(name, "")
+	m.mqttPub <- msg
+	msg.Topic, _ = mqtt_agent.MsgPubAdvInfo(name, "")
+	m.mqttPub <- msg
+}
@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	for payload, expected := range map[string]string{
+		"pause":               commandPause,
+		" Resume ":            commandResume,
+		`{"action": "reset"}`: commandReset,
+		`{"Action": "PAUSE"}`: commandPause,
+	} {
+		cmd, err := parseCommand(payload)
+		if err != nil || cmd.Action != expected {
+			t.Fatalf("parseCommand(%q) = %+v, %v; expected %s", payload, cmd, err, expected)
+		}
+	}
+
+	for _, payload := range []string{"", `{"action": ""}`, `{"action":`} {
+		if _, err := parseCommand(payload); err == nil {
+			t.Fatalf("expected error parsing %q", payload)
+		}
+	}
+}
+
+func TestPauseAndResumeCommands(t *testing.T) {
+	m, pub := newTestManager()
+	destination := &Destination{Name: "tv", inactive: true, state: "inactive"}
+	m.destinationMap[destination.Name] = destination
+
+	// paused while outside of its schedule: no pinger to start or stop, just the state
+	m.pauseCommand(destination)
+	if !destination.paused || destination.state != "paused" {
+		t.Fatalf("unexpected destination after pause: %+v", destination)
+	}
+	m.resumeCommand(destination)
+	if destination.paused || destination.state != "inactive" {
+		t.Fatalf("unexpected destination after resume: %+v", destination)
+	}
+	if len(pub) != 4 {
+		t.Fatalf("expected state and info published twice, got %d messages", len(pub))
+	}
+}
+
+func TestResetDestination(t *testing.T) {
+	m, pub := newTestManager()
+	destination := &Destination{Name: "nas", packetsSent: 10, packetsRecv: 7, consecutiveOfflines: 2}
+	m.destinationMap[destination.Name] = destination
+	destination.recordStats(time.Now().Add(-time.Minute))
+	destination.packetsSent, destination.packetsRecv = 20, 17
+	destination.recordStats(time.Now())
+
+	m.resetDestination(destination)
+	if destination.packetsSent != 0 || destination.packetsRecv != 0 || destination.consecutiveOfflines != 0 {
+		t.Fatalf("unexpected counters after reset: %+v", destination)
+	}
+	// the samples before the reset would make the window stats negative
+	if sent, received := destination.windowStats(); sent != 0 || received != 0 || destination.statsSamples != nil {
+		t.Fatalf("unexpected window stats after reset: sent %d received %d", sent, received)
+	}
+	if len(pub) != 2 {
+		t.Fatalf("expected state and info published, got %d messages", len(pub))
+	}
+}
+
+func TestRenameDestination(t *testing.T) {
+	m, pub := newTestManager()
+	parent := &Destination{Name: "router", Addr: "192.168.1.1", state: "online", source: sourceMqtt}
+	child := &Destination{Name: "tv", DependsOn: []string{"router"}, source: sourceMqtt}
+	m.destinationMap[parent.Name] = parent
+	m.destinationMap[child.Name] = child
+
+	for _, name := range []string{"", "a/b", "tv"} {
+		if err := m.renameDestination(parent, name); err == nil {
+			t.Fatalf("expected error renaming to %q", name)
+		}
+	}
+
+	parent.packetsSent = 42
+	if err := m.renameDestination(parent, "gateway"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := m.destinationMap["router"]; ok || m.destinationMap["gateway"] != parent {
+		t.Fatalf("destination not moved: %v", m.destinationMap)
+	}
+	if parent.Name != "gateway" || parent.packetsSent != 42 || parent.state != "online" {
+		t.Fatalf("unexpected destination after rename: %+v", parent)
+	}
+	if child.DependsOn[0] != "gateway" {
+		t.Fatalf("dependency not renamed: %v", child.DependsOn)
+	}
+
+	// destination moved to the new name, old state and info cleared, then new
+	// state and info published
+	if len(pub) != 6 {
+		t.Fatalf("expected 6 messages, got %d", len(pub))
+	}
+	moved := <-pub
+	if !moved.Retained || moved.Topic != "destination/gateway" || !strings.Contains(moved.Payload, `"address":"192.168.1.1"`) {
+		t.Fatalf("unexpected destination topic of new name: %+v", moved)
+	}
+	cleared := <-pub
+	if !cleared.Retained || cleared.Payload != "" || cleared.Topic != "destination/router" {
+		t.Fatalf("unexpected clear of destination topic: %+v", cleared)
+	}
+	for i := 0; i < 2; i++ {
+		msg := <-pub
+		if !msg.Retained || msg.Payload != "" || !strings.HasSuffix(msg.Topic, "/router") {
+			t.Fatalf("unexpected clear message: %+v", msg)
+		}
+	}
+	for len(pub) > 0 {
+		<-pub
+	}
+
+	// the echoes of both destination topics are ignored, rather than deleting
+	// router again or updating gateway
+	m.msgParseConfig("mqtt2ping/destination/gateway", moved.Payload)
+	m.msgParseConfig("mqtt2ping/destination/router", "")
+	if len(pub) != 0 || m.destinationMap["gateway"] != parent {
+		t.Fatalf("expected echoes to be ignored, got %d messages", len(pub))
+	}
+	// but not later messages on the topics
+	m.msgParseConfig("mqtt2ping/destination/router", "")
+	if msg := <-pub; msg.Topic != "result/router" || !strings.Contains(msg.Payload, `"code":"not_found"`) {
+		t.Fatalf("expected not_found result, got %+v", msg)
+	}
+}
+
+func TestRenameRejectedForConfiguredDestinations(t *testing.T) {
+	m, pub := newTestManager()
+	for _, source := range []string{sourceYaml, "file:/var/lib/misc/dnsmasq.leases"} {
+		destination := &Destination{Name: "nas", source: source}
+		m.destinationMap = map[string]*Destination{"nas": destination}
+		if err := m.renameDestination(destination, "storage"); err == nil {
+			t.Fatalf("expected error renaming destination from %s", source)
+		}
+		if m.destinationMap["nas"] != destination || destination.Name != "nas" {
+			t.Fatalf("destination from %s renamed: %v", source, m.destinationMap)
+		}
+	}
+
+	m.msgParseCommand("mqtt2ping/command/nas", `{"action":"rename","to":"storage"}`)
+	msg := <-pub
+	if msg.Topic != "result/nas" || !strings.Contains(msg.Payload, `"code":"invalid"`) {
+		t.Fatalf("expected invalid result, got %+v", msg)
+	}
+	if len(pub) != 0 {
+		t.Fatalf("expected only the result, got %d more messages", len(pub))
+	}
+}
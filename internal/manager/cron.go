@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed 5 field cron expression: minute hour day-of-month month day-of-week.
+// Each field supports '*', numbers, ranges (a-b), lists (a,b) and steps (*/n, a-b/n).
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+	var c cronSchedule
+	var err error
+	if c.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("cron %q minute: %w", expr, err)
+	}
+	if c.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("cron %q hour: %w", expr, err)
+	}
+	if c.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("cron %q day of month: %w", expr, err)
+	}
+	if c.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("cron %q month: %w", expr, err)
+	}
+	if c.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("cron %q day of week: %w", expr, err)
+	}
+	// both 0 and 7 are sunday
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	c.anyDay = fields[2] == "*"
+	c.anyWeekday = fields[4] == "*"
+	return &c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matches tells whether the cron fires at the minute of t
+func (c *cronSchedule) matches(t time.Time) bool {
+	return c.minutes&(1<<uint(t.Minute())) != 0 && c.hours&(1<<uint(t.Hour())) != 0 && c.matchesDay(t)
+}
+
+// matchesDay tells whether the cron fires at some time on the day of t
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	if c.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dayMatch := c.days&(1<<uint(t.Day())) != 0
+	weekdayMatch := c.weekdays&(1<<uint(t.Weekday())) != 0
+	// like cron, when both day fields are restricted either one matching is enough
+	if !c.anyDay && !c.anyWeekday {
+		return dayMatch || weekdayMatch
+	}
+	return dayMatch && weekdayMatch
+}
+
+// latestBit returns the highest value of a field no greater than max, or -1 if none
+func latestBit(field uint64, max int) int {
+	if max < 0 {
+		return -1
+	}
+	return bits.Len64(field&(1<<uint(max+1)-1)) - 1
+}
+
+// lastFire returns the most recent time, no earlier than after, at which the cron fired.
+// It goes back a day at a time, taking the latest hour and minute of the fields on each.
+func (c *cronSchedule) lastFire(now, after time.Time) (time.Time, bool) {
+	now = now.Truncate(time.Minute)
+	loc := now.Location()
+	year, month, day := now.Date()
+	hour, minute := now.Hour(), now.Minute()
+	for {
+		if c.matchesDay(time.Date(year, month, day, 12, 0, 0, 0, loc)) {
+			for h := latestBit(c.hours, hour); h >= 0; h = latestBit(c.hours, h-1) {
+				maxMinute := 59
+				if h == hour {
+					maxMinute = minute
+				}
+				if m := latestBit(c.minutes, maxMinute); m >= 0 {
+					t := time.Date(year, month, day, h, m, 0, 0, loc)
+					if t.Before(after) {
+						return time.Time{}, false
+					}
+					return t, true
+				}
+			}
+		}
+		// the previous day, from its last minute
+		year, month, day = time.Date(year, month, day-1, 12, 0, 0, 0, loc).Date()
+		hour, minute = 23, 59
+		if time.Date(year, month, day, hour, minute, 0, 0, loc).Before(after) {
+			return time.Time{}, false
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+const (
+	// dependencyModeUnreachable publishes children of an offline parent as unreachable
+	dependencyModeUnreachable = "unreachable"
+	// dependencyModeSuppress does not publish children of an offline parent going offline
+	dependencyModeSuppress = "suppress"
+)
+
+func validDependencyMode(mode string) error {
+	switch mode {
+	case dependencyModeUnreachable, dependencyModeSuppress:
+		return nil
+	}
+	return fmt.Errorf("invalid dependency mode %q", mode)
+}
+
+// isDetermined tells whether enough pings happened to know the destination state
+func (d *Destination) isDetermined() bool {
+	return d.lastIsOnline || d.consecutiveOfflines >= offlineThreshold
+}
+
+// currentState is the state of the destination as of the last status update. Until
+// its state is determined, it is reported as unknown.
+func (d *Destination) currentState() string {
+	if d.state == "" {
+		return mqtt_agent.StateUnknown
+	}
+	return d.state
+}
+
+// downParent returns the name of a destination this one depends on which is not
+// online, including parents that just missed a reply and are on their way to offline
+func (m *Manager) downParent(destination *Destination) (string, bool) {
+	for _, name := range destination.DependsOn {
+		parent, ok := m.destinationMap[name]
+		if !ok || parent == destination {
+			continue
+		}
+		if !parent.lastIsOnline || parent.consecutiveOfflines > 0 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// destinationState derives the state to publish from the ping results of the
+// destination and the ones it depends on
+func (m *Manager) destinationState(destination *Destination) string {
+	if destination.lastIsOnline {
+		return mqtt_agent.StateOnline
+	}
+	if destination.inMaintenance(time.Now()) {
+		return mqtt_agent.StateMaintenance
+	}
+	if _, ok := m.downParent(destination); ok {
+		return mqtt_agent.StateUnreachable
+	}
+	return mqtt_agent.StateOffline
+}
+
+// publishStateChange publishes the destination if its derived state differs from
+// the one it had after the previous status update
+func (m *Manager) publishStateChange(destination *Destination) {
+	state := m.destinationState(destination)
+	if state == destination.state {
+		return
+	}
+	if state == mqtt_agent.StateOnline {
+		destination.downSince = time.Time{}
+	} else if !destination.isDown() {
+		destination.downSince = time.Now()
+	}
+	destination.setState(state)
+	if state == mqtt_agent.StateUnreachable && m.dependencyMode == dependencyModeSuppress {
+		parent, _ := m.downParent(destination)
+		logger.Infof("%s pinger is now offline, not published because %s is down", destination.Name, parent)
+		return
+	}
+	logger.Infof("%s pinger is now %s", destination.Name, state)
+	m.publishDestination(destination)
+}
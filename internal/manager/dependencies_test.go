@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+func TestDestinationStateWithDependencies(t *testing.T) {
+	router := &Destination{Name: "router", lastIsOnline: true}
+	tv := &Destination{Name: "tv", DependsOn: []string{"wan", "router"}}
+	m := &Manager{destinationMap: map[string]*Destination{"router": router, "tv": tv}}
+
+	if state := m.destinationState(tv); state != mqtt_agent.StateOffline {
+		t.Fatalf("expected offline with parent online, got %s", state)
+	}
+
+	router.consecutiveOfflines = 1
+	if state := m.destinationState(tv); state != mqtt_agent.StateUnreachable {
+		t.Fatalf("expected unreachable with parent missing replies, got %s", state)
+	}
+
+	router.lastIsOnline = false
+	tv.lastIsOnline = true
+	if state := m.destinationState(tv); state != mqtt_agent.StateOnline {
+		t.Fatalf("expected online regardless of parent, got %s", state)
+	}
+}
+
+func TestCurrentStateUnknownUntilDetermined(t *testing.T) {
+	d := &Destination{Name: "nas"}
+	if state := d.currentState(); state != mqtt_agent.StateUnknown {
+		t.Fatalf("expected unknown, got %s", state)
+	}
+	d.state = mqtt_agent.StateOffline
+	if state := d.currentState(); state != mqtt_agent.StateOffline {
+		t.Fatalf("expected offline, got %s", state)
+	}
+}
+
+func TestUnknownPublishedOnAddAndResume(t *testing.T) {
+	m, pub := newTestManager()
+	if err := m.addDestination(Destination{Name: "nas", Addr: "127.0.0.1", source: sourceMqtt}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nas := m.destinationMap["nas"]
+	defer nas.stopProbe()
+
+	expectState := func(state string) {
+		t.Helper()
+		if len(pub) != 2 {
+			t.Fatalf("expected state and info, got %d messages", len(pub))
+		}
+		if msg := <-pub; msg.Topic != "state/nas" || msg.Payload != state {
+			t.Fatalf("expected %s published, got %+v", state, msg)
+		}
+		<-pub
+	}
+	expectState(mqtt_agent.StateUnknown)
+
+	nas.state = mqtt_agent.StateOnline
+	m.pauseCommand(nas)
+	expectState(mqtt_agent.StatePaused)
+	m.resumeCommand(nas)
+	expectState(mqtt_agent.StateUnknown)
+}
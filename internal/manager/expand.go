@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// fileReference is the prefix of a reference to the content of a file, such as a
+// mounted secret
+const fileReference = "file:"
+
+// referencePattern matches ${VAR} and ${file:/path}. A leading $ escapes it, so
+// $${VAR} stands for a literal ${VAR}.
+var referencePattern = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// expandString replaces the references in s with the value of the environment
+// variable or the content of the file, without its trailing newline
+func expandString(s string) (string, error) {
+	var err error
+	expanded := referencePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		name := match[2 : len(match)-1]
+		if strings.HasPrefix(name, fileReference) {
+			data, readErr := os.ReadFile(strings.TrimPrefix(name, fileReference))
+			if readErr != nil && err == nil {
+				err = fmt.Errorf("unable to expand %s: %w", match, readErr)
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("unable to expand %s: environment variable %s is not set", match, name)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// expandValue expands the references in all strings of a decoded yaml value
+func expandValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return expandString(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			expanded, err := expandValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			v[key] = expanded
+		}
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := expandValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			v[i] = expanded
+		}
+	}
+	return value, nil
+}
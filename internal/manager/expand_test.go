@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandString(t *testing.T) {
+	secretFilename := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFilename, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MQTT2PING_TEST_HOST", "nas.lan")
+
+	for s, expected := range map[string]string{
+		"plain":                          "plain",
+		"${MQTT2PING_TEST_HOST}":         "nas.lan",
+		"x-${MQTT2PING_TEST_HOST}-y":     "x-nas.lan-y",
+		"${file:" + secretFilename + "}": "s3cret",
+		"$${MQTT2PING_TEST_HOST}":        "${MQTT2PING_TEST_HOST}",
+		"$HOME":                          "$HOME",
+	} {
+		if got, err := expandString(s); err != nil || got != expected {
+			t.Fatalf("expandString(%q) = %q, %v; expected %q", s, got, err, expected)
+		}
+	}
+
+	for _, s := range []string{"${MQTT2PING_TEST_UNSET}", "${file:/nonexistent/secret}"} {
+		if _, err := expandString(s); err == nil {
+			t.Fatalf("expected error expanding %q", s)
+		}
+	}
+}
+
+func TestExpandValue(t *testing.T) {
+	t.Setenv("MQTT2PING_TEST_INTERVAL", "30")
+	value := map[string]interface{}{
+		"interval":     "${MQTT2PING_TEST_INTERVAL}",
+		"destinations": []interface{}{map[string]interface{}{"address": "${MQTT2PING_TEST_INTERVAL}.0.0.1", "interval": 5}},
+	}
+	expanded, err := expandValue(value)
+	expected := map[string]interface{}{
+		"interval":     "30",
+		"destinations": []interface{}{map[string]interface{}{"address": "30.0.0.1", "interval": 5}},
+	}
+	if err != nil || !reflect.DeepEqual(expanded, expected) {
+		t.Fatalf("expandValue() = %v, %v", expanded, err)
+	}
+}
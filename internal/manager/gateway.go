@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/antigloss/go/logger"
+)
+
+const (
+	procNetRoute     = "/proc/net/route"
+	procNetIpv6Route = "/proc/net/ipv6_route"
+
+	// rtfGateway is the RTF_GATEWAY route flag
+	rtfGateway = 0x2
+)
+
+// defaultGateway returns the current IPv4 default gateway, falling back to the
+// IPv6 one when there is no IPv4 default route
+func defaultGateway() (string, error) {
+	if f, err := os.Open(procNetRoute); err == nil {
+		gateway, err := parseIpv4DefaultGateway(f)
+		f.Close()
+		if err == nil {
+			return gateway, nil
+		}
+	}
+	f, err := os.Open(procNetIpv6Route)
+	if err != nil {
+		return "", fmt.Errorf("no default gateway: %w", err)
+	}
+	defer f.Close()
+	return parseIpv6DefaultGateway(f)
+}
+
+// parseIpv4DefaultGateway reads /proc/net/route and returns the gateway of the
+// default route with the lowest metric
+func parseIpv4DefaultGateway(r io.Reader) (string, error) {
+	gateway := ""
+	bestMetric := -1
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfGateway == 0 {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		metric, _ := strconv.Atoi(fields[6])
+		if bestMetric != -1 && metric >= bestMetric {
+			continue
+		}
+		// the kernel writes the address in host byte order
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.NativeEndian.Uint32(raw))
+		gateway, bestMetric = ip.String(), metric
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if gateway == "" {
+		return "", fmt.Errorf("no ipv4 default route")
+	}
+	return gateway, nil
+}
+
+// parseIpv6DefaultGateway reads /proc/net/ipv6_route and returns the next hop of
+// the default route with the lowest metric. Link local gateways get the interface
+// as their zone, so they can be pinged.
+func parseIpv6DefaultGateway(r io.Reader) (string, error) {
+	gateway := ""
+	var bestMetric uint64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// dest dest_prefix src src_prefix next_hop metric refcnt use flags iface
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[0] != strings.Repeat("0", 32) || fields[1] != "00" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[4])
+		if err != nil || len(raw) != net.IPv6len {
+			continue
+		}
+		ip := net.IP(raw)
+		if ip.IsUnspecified() {
+			continue
+		}
+		metric, err := strconv.ParseUint(fields[5], 16, 32)
+		if err != nil || (gateway != "" && metric >= bestMetric) {
+			continue
+		}
+		gateway, bestMetric = ip.String(), metric
+		if ip.IsLinkLocalUnicast() {
+			gateway += "%" + fields[9]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if gateway == "" {
+		return "", fmt.Errorf("no ipv6 default route")
+	}
+	return gateway, nil
+}
+
+// refreshGateways restarts the pinger of gateway destinations whose default
+// gateway is no longer the one being pinged
+func (m *Manager) refreshGateways() {
+	for _, destination := range m.destinationMap {
+		if destination.Type != destinationTypeGateway || !destination.isProbing() {
+			continue
+		}
+		gateway, err := defaultGateway()
+		if err != nil {
+			logger.Tracef("%s unable to detect default gateway: %v", destination.Name, err)
+			continue
+		}
+		if len(destination.targetAddrs) == 1 && destination.targetAddrs[0] == gateway {
+			continue
+		}
+		destination.stopProbe()
+		if err = destination.startProbe([]string{gateway}); err != nil {
+			logger.Errorf("%s unable to ping new gateway %s: %v", destination.Name, gateway, err)
+			continue
+		}
+		logger.Infof("%s default gateway is now %s", destination.Name, gateway)
+	}
+}
@@ -0,0 +1,33 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseIpv4DefaultGateway(t *testing.T) {
+	routes := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0102A8C0	0003	0	0	600	00000000	0	0	0
+wlan0	00000000	FE01A8C0	0003	0	0	100	00000000	0	0	0
+eth0	0002A8C0	00000000	0001	0	0	600	00FFFFFF	0	0	0
+`
+	gateway, err := parseIpv4DefaultGateway(strings.NewReader(routes))
+	if err != nil || gateway != "192.168.1.254" {
+		t.Fatalf("unexpected gateway %q: %v", gateway, err)
+	}
+
+	if _, err = parseIpv4DefaultGateway(strings.NewReader(routes[:strings.Index(routes, "\n")+1])); err == nil {
+		t.Fatal("expected error when there is no default route")
+	}
+}
+
+func TestParseIpv6DefaultGateway(t *testing.T) {
+	routes := `fd000000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+`
+	gateway, err := parseIpv6DefaultGateway(strings.NewReader(routes))
+	if err != nil || gateway != "fe80::1%eth0" {
+		t.Fatalf("unexpected gateway %q: %v", gateway, err)
+	}
+}
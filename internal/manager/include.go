@@ -0,0 +1,174 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/antigloss/go/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// configIncludes returns the include entries of a config yaml file, which can be a
+// single path or glob, or a list of them
+func configIncludes(configFilename string) ([]string, error) {
+	data, err := os.ReadFile(configFilename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open pinger destinations %s: %w", configFilename, err)
+	}
+	var header struct {
+		Include interface{} `yaml:"include"`
+	}
+	if err = yaml.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("unable to parse yaml pinger destinations %s: %w", configFilename, err)
+	}
+	if header.Include, err = expandValue(header.Include); err != nil {
+		return nil, fmt.Errorf("unable to expand include of %s: %w", configFilename, err)
+	}
+	switch include := header.Include.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{include}, nil
+	case []interface{}:
+		includes := make([]string, 0, len(include))
+		for _, entry := range include {
+			s, ok := entry.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid include %v in %s", entry, configFilename)
+			}
+			includes = append(includes, s)
+		}
+		return includes, nil
+	}
+	return nil, fmt.Errorf("invalid include %v in %s", header.Include, configFilename)
+}
+
+// configDirFiles returns the yaml files of a directory, in lexical order
+func configDirFiles(dir string) []string {
+	var filenames []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		filenames = append(filenames, matches...)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+// configFiles returns the files that make up the config, in the order they are
+// merged. A directory stands for its yaml files in lexical order, and the files
+// included by a file come right after it. Relative includes are relative to the
+// directory of the file that includes them. Each file is used only once.
+func configFiles(configPath string) ([]string, error) {
+	var filenames []string
+	seen := make(map[string]bool)
+
+	var add func(path string) error
+	add = func(path string) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("unable to open pinger destinations %s: %w", path, err)
+		}
+		if info.IsDir() {
+			for _, filename := range configDirFiles(path) {
+				if err = add(filename); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if abs, err := filepath.Abs(path); err == nil {
+			if seen[abs] {
+				return nil
+			}
+			seen[abs] = true
+		}
+		filenames = append(filenames, path)
+
+		includes, err := configIncludes(path)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range includes {
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid include %s in %s: %w", pattern, path, err)
+			}
+			if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+				return fmt.Errorf("unable to open %s, included by %s", pattern, path)
+			}
+			for _, match := range matches {
+				if err = add(match); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := add(configPath); err != nil {
+		return nil, err
+	}
+	return filenames, nil
+}
+
+// mergeConfig merges the config of a file into the one of the files before it.
+// Settings are taken from the first file that has them, and destinations from the
+// first file that has their name; owners tells which file that was.
+func mergeConfig(d, fileConfig *Destinations, filename string, owners map[string]string) {
+	conflict := func(setting string) {
+		logger.Warnf("Ignoring %s from %s: already set by a previous config file", setting, filename)
+	}
+	if fileConfig.DefaultIntervalSeconds != 0 {
+		if d.DefaultIntervalSeconds == 0 {
+			d.DefaultIntervalSeconds = fileConfig.DefaultIntervalSeconds
+		} else {
+			conflict("interval")
+		}
+	}
+	if fileConfig.AdvertisementsSeconds != 0 {
+		if d.AdvertisementsSeconds == 0 {
+			d.AdvertisementsSeconds = fileConfig.AdvertisementsSeconds
+		} else {
+			conflict("advertisements")
+		}
+	}
+	if fileConfig.UpdateStatusIntervalSeconds != 0 {
+		if d.UpdateStatusIntervalSeconds == 0 {
+			d.UpdateStatusIntervalSeconds = fileConfig.UpdateStatusIntervalSeconds
+		} else {
+			conflict("update-interval")
+		}
+	}
+	if fileConfig.DependencyMode != "" {
+		if d.DependencyMode == "" {
+			d.DependencyMode = fileConfig.DependencyMode
+		} else {
+			conflict("dependency-mode")
+		}
+	}
+	if fileConfig.Outage != nil {
+		if d.Outage == nil {
+			d.Outage = fileConfig.Outage
+		} else {
+			conflict("outage")
+		}
+	}
+
+	for _, destination := range fileConfig.Destinations {
+		name := destinationName(&destination)
+		if owner, ok := owners[name]; ok && name != "" {
+			logger.Warnf("Ignoring destination %s from %s: already defined in %s", name, filename, owner)
+			continue
+		}
+		owners[name] = filename
+		d.Destinations = append(d.Destinations, destination)
+	}
+	d.Sources = append(d.Sources, fileConfig.Sources...)
+}
@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yaml":       "include: [teams/*.yaml, extra.yml]\n",
+		"teams/b.yaml":    "include: ../main.yaml\n",
+		"teams/a.yaml":    "",
+		"teams/notes.txt": "",
+		"extra.yml":       "",
+	})
+	filenames, err := configFiles(filepath.Join(dir, "main.yaml"))
+	expected := []string{"main.yaml", "teams/a.yaml", "teams/b.yaml", "extra.yml"}
+	for i := range expected {
+		expected[i] = filepath.Join(dir, expected[i])
+	}
+	if err != nil || !reflect.DeepEqual(filenames, expected) {
+		t.Fatalf("configFiles() = %v, %v; expected %v", filenames, err, expected)
+	}
+
+	filenames, err = configFiles(filepath.Join(dir, "teams"))
+	if err != nil || len(filenames) != 4 || filenames[0] != filepath.Join(dir, "teams/a.yaml") {
+		t.Fatalf("unexpected files of directory: %v, %v", filenames, err)
+	}
+
+	writeFiles(t, dir, map[string]string{"broken.yaml": "include: missing.yaml\n"})
+	if _, err = configFiles(filepath.Join(dir, "broken.yaml")); err == nil {
+		t.Fatal("expected error for missing include")
+	}
+}
+
+func TestReadConfigMerge(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"00-base.yaml":   "interval: 10\ndestinations:\n  - {name: router, address: 192.168.1.1}\n",
+		"10-team-a.yaml": "interval: 20\ndependency-mode: suppress\ndestinations:\n  - {name: nas, address: 192.168.1.5}\n",
+		"20-team-b.yaml": "destinations:\n  - {name: nas, address: 192.168.1.6}\n  - {address: 192.168.1.7}\n",
+	})
+	d, err := readConfig(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.DefaultIntervalSeconds != 10 || d.DependencyMode != dependencyModeSuppress {
+		t.Fatalf("unexpected settings: %+v", d)
+	}
+	var addrs []string
+	for _, destination := range d.Destinations {
+		addrs = append(addrs, destination.Addr)
+		if destination.source != sourceYaml {
+			t.Fatalf("unexpected source of %s: %s", destination.Name, destination.source)
+		}
+	}
+	if !reflect.DeepEqual(addrs, []string{"192.168.1.1", "192.168.1.5", "192.168.1.7"}) {
+		t.Fatalf("expected first destination with a name to win, got %v", addrs)
+	}
+}
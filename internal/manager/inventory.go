@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+// destinationConfigJson is the effective config of a destination, published on its config topic
+type destinationConfigJson struct {
+	Name string `json:"name"`
+	destinationJson
+	Ip                string `json:"ip"`
+	IntervalInSeconds int    `json:"interval_in_seconds"`
+	Source            string `json:"source"`
+}
+
+// inventoryJson lists all destinations, published on the inventory topic
+type inventoryJson struct {
+	Count        int      `json:"count"`
+	Destinations []string `json:"destinations"`
+}
+
+func (d *Destination) effectiveConfig() destinationConfigJson {
+	return destinationConfigJson{
+		Name:              d.Name,
+		destinationJson:   d.toJson(),
+		Ip:                d.ipString(),
+		IntervalInSeconds: int(d.interval.Seconds()),
+		Source:            d.source,
+	}
+}
+
+// publishConfigs publishes, retained, the config of destinations that changed
+// since they were last published, and the inventory if destinations were added
+// or removed. The config topics of removed destinations are cleared.
+func (m *Manager) publishConfigs() {
+	names := make([]string, 0, len(m.destinationMap))
+	for name, destination := range m.destinationMap {
+		names = append(names, name)
+		payload, err := json.Marshal(destination.effectiveConfig())
+		if err != nil {
+			logger.Errorf("Unable to encode config of destination %s: %v", name, err)
+			continue
+		}
+		if m.publishedConfigs[name] == string(payload) {
+			continue
+		}
+		m.publishedConfigs[name] = string(payload)
+		msg := mqtt_agent.Msg{Retained: true}
+		msg.Topic, msg.Payload = mqtt_agent.MsgPubConfig(name, string(payload))
+		m.mqttPub <- msg
+	}
+	for name := range m.publishedConfigs {
+		if _, ok := m.destinationMap[name]; !ok {
+			delete(m.publishedConfigs, name)
+			msg := mqtt_agent.Msg{Retained: true}
+			msg.Topic, _ = mqtt_agent.MsgPubConfig(name, "")
+			m.mqttPub <- msg
+		}
+	}
+
+	sort.Strings(names)
+	payload, err := json.Marshal(inventoryJson{Count: len(names), Destinations: names})
+	if err != nil {
+		logger.Errorf("Unable to encode inventory: %v", err)
+		return
+	}
+	if m.publishedInventory == string(payload) {
+		return
+	}
+	m.publishedInventory = string(payload)
+	msg := mqtt_agent.Msg{Retained: true}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubInventory(string(payload))
+	m.mqttPub <- msg
+	logger.Infof("Published inventory of %d destinations", len(names))
+}
@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublishConfigs(t *testing.T) {
+	m, pub := newTestManager()
+	m.destinationMap["nas"] = &Destination{Name: "nas", Addr: "192.168.1.5", Tags: []string{"lan"},
+		interval: 10 * time.Second, source: sourceYaml}
+	m.destinationMap["tv"] = &Destination{Name: "tv", Addr: "192.168.1.6", interval: 3 * time.Second, source: sourceMqtt}
+
+	m.publishConfigs()
+	if len(pub) != 3 {
+		t.Fatalf("expected 2 configs and the inventory, got %d messages", len(pub))
+	}
+	for len(pub) > 0 {
+		msg := <-pub
+		if !msg.Retained {
+			t.Fatalf("expected retained message: %+v", msg)
+		}
+		if strings.HasSuffix(msg.Topic, "inventory") {
+			if msg.Payload != `{"count":2,"destinations":["nas","tv"]}` {
+				t.Fatalf("unexpected inventory: %s", msg.Payload)
+			}
+			continue
+		}
+		var config destinationConfigJson
+		if err := json.Unmarshal([]byte(msg.Payload), &config); err != nil {
+			t.Fatalf("unexpected config %s: %v", msg.Payload, err)
+		}
+		if config.Name == "nas" && (config.IntervalInSeconds != 10 || config.Source != sourceYaml || config.Tags[0] != "lan") {
+			t.Fatalf("unexpected config of nas: %+v", config)
+		}
+	}
+
+	// nothing changed, nothing published
+	m.publishConfigs()
+	if len(pub) != 0 {
+		t.Fatalf("expected no messages, got %d", len(pub))
+	}
+
+	delete(m.destinationMap, "tv")
+	m.publishConfigs()
+	if len(pub) != 2 {
+		t.Fatalf("expected config cleared and inventory, got %d messages", len(pub))
+	}
+	if msg := <-pub; !strings.HasSuffix(msg.Topic, "config/tv") || msg.Payload != "" {
+		t.Fatalf("expected config of tv to be cleared: %+v", msg)
+	}
+}
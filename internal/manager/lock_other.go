@@ -0,0 +1,8 @@
+//go:build !unix
+
+package manager
+
+// lockFile does not lock anything where flock is not available
+func lockFile(filename string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+// MaintenanceWindow is a period during which a destination is still pinged, but
+// going offline is published as maintenance. It is either a one-off window with
+// start and end (RFC3339), or a recurring one given as a cron and a duration.
+type MaintenanceWindow struct {
+	Start           string `mapstructure:"start" json:"start,omitempty"`
+	End             string `mapstructure:"end" json:"end,omitempty"`
+	Cron            string `mapstructure:"cron" json:"cron,omitempty"`
+	DurationSeconds int    `mapstructure:"duration" json:"duration,omitempty"`
+	Timezone        string `mapstructure:"timezone" json:"timezone,omitempty"`
+}
+
+// maintenanceWindow is the parsed form of a MaintenanceWindow
+type maintenanceWindow struct {
+	start, end time.Time
+	cron       *cronSchedule
+	duration   time.Duration
+	location   *time.Location
+}
+
+// silenceJson is the payload of the silence topic. A plain number of seconds is
+// also accepted, and an empty payload removes the silence.
+type silenceJson struct {
+	Duration int
+	Until    string
+}
+
+func parseMaintenanceWindow(w MaintenanceWindow) (maintenanceWindow, error) {
+	var mw maintenanceWindow
+	var err error
+	if w.Cron != "" {
+		if w.Start != "" || w.End != "" {
+			return mw, fmt.Errorf("maintenance window has both cron and start/end")
+		}
+		if w.DurationSeconds <= 0 {
+			return mw, fmt.Errorf("maintenance cron %q needs a duration", w.Cron)
+		}
+		if mw.cron, err = parseCron(w.Cron); err != nil {
+			return mw, err
+		}
+		mw.duration = time.Duration(w.DurationSeconds) * time.Second
+		mw.location = time.Local
+		if w.Timezone != "" {
+			if mw.location, err = time.LoadLocation(w.Timezone); err != nil {
+				return mw, fmt.Errorf("maintenance timezone: %w", err)
+			}
+		}
+		return mw, nil
+	}
+
+	if mw.start, err = time.Parse(time.RFC3339, w.Start); err != nil {
+		return mw, fmt.Errorf("maintenance start: %w", err)
+	}
+	if mw.end, err = time.Parse(time.RFC3339, w.End); err != nil {
+		return mw, fmt.Errorf("maintenance end: %w", err)
+	}
+	if !mw.end.After(mw.start) {
+		return mw, fmt.Errorf("maintenance end %s is not after start %s", w.End, w.Start)
+	}
+	return mw, nil
+}
+
+func (mw *maintenanceWindow) active(now time.Time) bool {
+	if mw.cron == nil {
+		return !now.Before(mw.start) && now.Before(mw.end)
+	}
+	now = now.In(mw.location)
+	_, ok := mw.cron.lastFire(now, now.Add(-mw.duration).Add(time.Second))
+	return ok
+}
+
+// inMaintenance tells whether the destination is silenced or in one of its
+// maintenance windows
+func (d *Destination) inMaintenance(now time.Time) bool {
+	if now.Before(d.silencedUntil) {
+		return true
+	}
+	for i := range d.maintenanceWindows {
+		if d.maintenanceWindows[i].active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) msgParseSilence(topic, payload string) {
+	name, ok := mqtt_agent.GetTopicSubDestinationSilence(topic)
+	if !ok {
+		logger.Errorf("Unexpected parsing of topic: %s", topic)
+		return
+	}
+	destination, ok := m.destinationMap[name]
+	if !ok {
+		logger.Warnf("Ignoring silence of destination %s: not-found", name)
+		m.publishResult(name, "silence", payload, errNotFound)
+		return
+	}
+
+	until, err := parseSilence(payload, time.Now())
+	if err != nil {
+		logger.Warnf("Ignoring silence of destination %s: %v", name, err)
+		m.publishResult(name, "silence", payload, err)
+		return
+	}
+	destination.silencedUntil = until
+	if until.IsZero() {
+		logger.Infof("Removed silence of destination %s", name)
+	} else {
+		logger.Infof("Silenced destination %s until %s", name, until.Format(time.RFC3339))
+	}
+	m.publishResult(name, "silence", payload, nil)
+}
+
+func parseSilence(payload string, now time.Time) (time.Time, error) {
+	payload = strings.TrimSpace(payload)
+	if payload == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.Atoi(payload); err == nil {
+		if seconds <= 0 {
+			return time.Time{}, nil
+		}
+		return now.Add(time.Duration(seconds) * time.Second), nil
+	}
+
+	var silence silenceJson
+	if err := json.Unmarshal([]byte(payload), &silence); err != nil {
+		return time.Time{}, fmt.Errorf("invalid payload %q: %w", payload, err)
+	}
+	switch {
+	case silence.Until != "":
+		return time.Parse(time.RFC3339, silence.Until)
+	case silence.Duration > 0:
+		return now.Add(time.Duration(silence.Duration) * time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("payload %q has neither duration nor until", payload)
+}
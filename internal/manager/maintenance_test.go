@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	c, err := parseCron("30 2 * * 0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sunday := time.Date(2024, 1, 7, 2, 30, 0, 0, time.UTC)
+	if !c.matches(sunday) {
+		t.Fatalf("expected cron to match %s", sunday)
+	}
+	if c.matches(sunday.Add(time.Minute)) || c.matches(sunday.AddDate(0, 0, 1)) {
+		t.Fatal("expected cron to only match sundays at 02:30")
+	}
+
+	c, err = parseCron("*/15 8-17/2 1,15 * 7")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// day of month and day of week are or'ed when both are restricted
+	if !c.matches(time.Date(2024, 1, 7, 10, 45, 0, 0, time.UTC)) {
+		t.Fatal("expected cron to match sunday 7th")
+	}
+	if !c.matches(time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)) {
+		t.Fatal("expected cron to match monday 15th")
+	}
+	if c.matches(time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)) {
+		t.Fatal("expected cron to skip odd hours")
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err = parseCron(expr); err == nil {
+			t.Fatalf("expected error parsing %q", expr)
+		}
+	}
+}
+
+func TestCronLastFire(t *testing.T) {
+	// walking back a minute at a time is the reference
+	lastFireByMinute := func(c *cronSchedule, now, after time.Time) (time.Time, bool) {
+		for t := now.Truncate(time.Minute); !t.Before(after); t = t.Add(-time.Minute) {
+			if c.matches(t) {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	now := time.Date(2024, 3, 1, 10, 17, 42, 0, time.UTC)
+	tests := []struct {
+		expr  string
+		after time.Duration
+	}{
+		{"0 2 * * *", 24 * time.Hour},
+		{"0 2 * * *", 8 * time.Hour},
+		{"*/15 * * * *", time.Hour},
+		{"17 10 * * *", time.Minute},
+		{"30 10 * * *", 48 * time.Hour},
+		{"0 0 29 2 *", 400 * 24 * time.Hour},
+		{"*/15 8-17/2 1,15 * 7", 30 * 24 * time.Hour},
+		{"59 23 * * 0", 7 * 24 * time.Hour},
+		{"0 12 * * 1-5", 3 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		after := now.Add(-tt.after)
+		got, ok := c.lastFire(now, after)
+		want, wantOk := lastFireByMinute(c, now, after)
+		if ok != wantOk || !got.Equal(want) {
+			t.Errorf("cron %q after %s: got %s %t, want %s %t", tt.expr, tt.after, got, ok, want, wantOk)
+		}
+	}
+}
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	mw, err := parseMaintenanceWindow(MaintenanceWindow{Cron: "0 2 * * *", DurationSeconds: 3600, Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !mw.active(time.Date(2024, 1, 1, 2, 59, 0, 0, time.UTC)) {
+		t.Fatal("expected window to be active within duration")
+	}
+	if mw.active(time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)) || mw.active(time.Date(2024, 1, 1, 1, 59, 0, 0, time.UTC)) {
+		t.Fatal("expected window to be inactive outside of duration")
+	}
+
+	mw, err = parseMaintenanceWindow(MaintenanceWindow{Start: "2024-01-01T00:00:00Z", End: "2024-01-01T01:00:00Z"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !mw.active(time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)) || mw.active(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)) {
+		t.Fatal("unexpected one-off window activity")
+	}
+
+	if _, err = parseMaintenanceWindow(MaintenanceWindow{Cron: "0 2 * * *"}); err == nil {
+		t.Fatal("expected error for cron without duration")
+	}
+}
+
+func TestParseSilence(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		payload  string
+		expected time.Time
+	}{
+		{"", time.Time{}},
+		{"600", now.Add(10 * time.Minute)},
+		{`{"duration": 60}`, now.Add(time.Minute)},
+		{`{"until": "2024-01-02T00:00:00Z"}`, now.AddDate(0, 0, 1)},
+	} {
+		until, err := parseSilence(tc.payload, now)
+		if err != nil || !until.Equal(tc.expected) {
+			t.Fatalf("parseSilence(%q) = %s, %v; expected %s", tc.payload, until, err, tc.expected)
+		}
+	}
+
+	if _, err := parseSilence(`{"foo": 1}`, now); err == nil {
+		t.Fatal("expected error for payload without duration or until")
+	}
+}
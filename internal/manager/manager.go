@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"sort"
+	"syscall"
 	"time"
 
 	"github.com/antigloss/go/logger"
@@ -22,29 +23,82 @@ const (
 
 	// minUpdateStatusIntervalSeconds is the smallest value we can safely use as status insterval
 	minUpdateStatusIntervalSeconds = 2
+
+	// offlineThreshold is how many status updates in a row without replies make a destination offline
+	offlineThreshold = 3
+
+	// sourceYaml and sourceMqtt tell where a destination came from. Destinations
+	// added by a Source use its id instead.
+	sourceYaml = "yaml"
+	sourceMqtt = "mqtt"
 )
 
 type destinationJson struct {
-	Address  string
-	Interval int
+	Address     string              `json:"address,omitempty"`
+	Interval    int                 `json:"interval,omitempty"`
+	Type        string              `json:"type,omitempty"`
+	Targets     []string            `json:"targets,omitempty"`
+	DependsOn   []string            `json:"depends_on,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+	Schedule    *Schedule           `json:"schedule,omitempty"`
 }
 
 type Destination struct {
-	Name                string
-	Addr                string `mapstructure:"address"`
-	IntervalSeconds     int    `mapstructure:"interval"`
-	pinger              *ping.Pinger
+	Name                string              `mapstructure:"name"`
+	Addr                string              `mapstructure:"address"`
+	IntervalSeconds     int                 `mapstructure:"interval"`
+	Type                string              `mapstructure:"type"`
+	Targets             []string            `mapstructure:"targets"`
+	DependsOn           []string            `mapstructure:"depends_on"`
+	Tags                []string            `mapstructure:"tags"`
+	Maintenance         []MaintenanceWindow `mapstructure:"maintenance"`
+	Schedule            *Schedule           `mapstructure:"schedule"`
+	interval            time.Duration
+	pingers             []*ping.Pinger
+	targetAddrs         []string
 	lastPacketsSent     int
 	lastPacketsRecv     int
+	packetsSent         int
+	packetsRecv         int
 	lastIsOnline        bool
 	consecutiveOfflines int
+	state               string
+	stateSince          time.Time
+	downSince           time.Time
+	statsSamples        []statsSample
+	maintenanceWindows  []maintenanceWindow
+	silencedUntil       time.Time
+	activeHours         *activeHours
+	inactive            bool
+	paused              bool
+	source              string
 }
 
 type Destinations struct {
-	DefaultIntervalSeconds      int           `mapstructure:"interval"`
-	AdvertisementsSeconds       int           `mapstructure:"advertisements"`
-	UpdateStatusIntervalSeconds int           `mapstructure:"update-interval"`
-	Destinations                []Destination `mapstructure:"destinations"`
+	DefaultIntervalSeconds      int              `mapstructure:"interval"`
+	AdvertisementsSeconds       int              `mapstructure:"advertisements"`
+	UpdateStatusIntervalSeconds int              `mapstructure:"update-interval"`
+	DependencyMode              string           `mapstructure:"dependency-mode"`
+	Outage                      *OutageConfig    `mapstructure:"outage"`
+	Destinations                []Destination    `mapstructure:"destinations"`
+	Sources                     []Source         `mapstructure:"sources"`
+	Include                     []string         `mapstructure:"include"`
+	Mqtt                        *MqttSettings    `mapstructure:"mqtt"`
+	Logging                     *LoggingSettings `mapstructure:"logging"`
+	skipped                     []string         // destinations that could not be decoded, and why
+}
+
+// Config holds the startup options of the manager
+type Config struct {
+	Filename        string // config yaml
+	PersistFilename string // where destinations added via mqtt are kept across restarts
+	StateFilename   string // where the state and counters of destinations are kept across restarts
+	Retain          bool   // publish state and info retained, and restore from them at startup
+	WatchConfig     bool   // reload the config yaml when its file changes, besides on SIGHUP
+
+	Subscribed   <-chan struct{} // closed once subscribed to mqtt, to know when retained messages were read back
+	StopRetained func()          // called once done restoring, to stop reading back our own retained publishes
 }
 
 type Manager struct {
@@ -52,47 +106,141 @@ type Manager struct {
 	defaultIntervalSeconds      int
 	advertisementsSeconds       int
 	updateStatusIntervalSeconds int
+	dependencyMode              string
+	outageConfig                *OutageConfig
+	outages                     map[string]*outage
+	advertiseTick               *time.Ticker
+	updateStatusTick            *time.Ticker
+	burstSlots                  chan struct{}
 	destinationMap              map[string]*Destination
+	sources                     []*Source
+	configFilename              string
+	configModTime               time.Time
+	watchConfig                 bool
+	persistFilename             string
+	persisted                   []byte
+	publishedConfigs            map[string]string
+	ownDestinationMsgs          map[string]string // payloads we published on destination topics, by name
+	publishedInventory          string
+	stateFilename               string
+	savedStates                 map[string]destinationStateJson
+	retain                      bool
+	restoring                   bool
+	subscribed                  <-chan struct{}
+	stopRetained                func()
+	persistUnlock               func()
 	mqttPub                     chan<- mqtt_agent.Msg
 	mqttSub                     <-chan mqtt_agent.Msg
 }
 
-func (m *Manager) parseYaml(configFilename string) error {
-	var err error
+// decodeConfigFile reads and decodes a single config yaml file
+func decodeConfigFile(configFilename string) (*Destinations, error) {
 	var raw interface{}
 
+	f, err := os.ReadFile(configFilename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open pinger destinations %s: %w", configFilename, err)
+	}
+
+	// Unmarshal our input YAML file into empty interface
+	if err = yaml.Unmarshal(f, &raw); err != nil {
+		return nil, fmt.Errorf("unable to parse yaml pinger destinations %s: %w", configFilename, err)
+	}
+	if raw, err = expandValue(raw); err != nil {
+		return nil, fmt.Errorf("unable to expand pinger destinations %s: %w", configFilename, err)
+	}
+
+	// Use mapstructure to convert our interface{} to Pinger destinations
+	destinations, skipped := takeConfigDestinations(raw)
+	d := &Destinations{}
+	decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{WeaklyTypedInput: true, Result: d})
+	if err = decoder.Decode(raw); err != nil {
+		return nil, fmt.Errorf("unable to assemble pinger destinations %s: %w", configFilename, err)
+	}
+	if destinations != nil {
+		d.Destinations = destinations
+	}
+	d.skipped = skipped
+	return d, nil
+}
+
+// readConfig reads and decodes the config, without applying it. The config is a
+// yaml file or a directory of them, plus the files they include.
+func readConfig(configFilename string) (*Destinations, error) {
+	d := &Destinations{}
 	if configFilename == "" {
 		logger.Warn("No config yaml file provided")
-	} else {
-		f, err := os.ReadFile(configFilename)
+		return d, nil
+	}
+
+	filenames, err := configFiles(configFilename)
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string]string)
+	for _, filename := range filenames {
+		fileConfig, err := decodeConfigFile(filename)
 		if err != nil {
-			return fmt.Errorf("unable to open pinger destinations %s: %w", configFilename, err)
+			return nil, err
 		}
-
-		// Unmarshal our input YAML file into empty interface
-		if err = yaml.Unmarshal(f, &raw); err != nil {
-			return fmt.Errorf("unable to parse yaml pinger destinations %s: %w", configFilename, err)
+		for _, problem := range fileConfig.skipped {
+			logger.Warnf("Ignoring destination in %s: %s", filename, problem)
+			d.skipped = append(d.skipped, fmt.Sprintf("%s: %s", filename, problem))
 		}
+		mergeConfig(d, fileConfig, filename, owners)
 	}
-
-	// Use mapstructure to convert our interface{} to Pinger destinations
-	d := Destinations{}
-	decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{WeaklyTypedInput: true, Result: &d})
-	if err = decoder.Decode(raw); err != nil {
-		return fmt.Errorf("unable to assemble pinger destinations %s: %w", configFilename, err)
+	if d.DependencyMode != "" {
+		if err := validDependencyMode(d.DependencyMode); err != nil {
+			return nil, fmt.Errorf("unable to use pinger destinations %s: %w", configFilename, err)
+		}
+	}
+	for i := range d.Destinations {
+		d.Destinations[i].source = sourceYaml
 	}
+	return d, nil
+}
 
-	// Assemble m.destinationMap from local copy of Destinations
+// applySettings applies the global settings of the config
+func (m *Manager) applySettings(d *Destinations) {
+	m.defaultIntervalSeconds = defaultIntervalSeconds
 	if d.DefaultIntervalSeconds != 0 {
 		m.defaultIntervalSeconds = d.DefaultIntervalSeconds
 	}
 	m.advertisementsSeconds = d.AdvertisementsSeconds
+	m.updateStatusIntervalSeconds = defaultUpdateStatusIntervalSeconds
 	if d.UpdateStatusIntervalSeconds != 0 {
 		m.updateStatusIntervalSeconds = d.UpdateStatusIntervalSeconds
 	}
+	m.dependencyMode = dependencyModeUnreachable
+	if d.DependencyMode != "" {
+		m.dependencyMode = d.DependencyMode
+	}
+	m.outageConfig = d.Outage
+	if d.Outage != nil {
+		d.Outage.applyDefaults()
+		logger.Infof("Outage detection enabled: %s", m.outageConfig)
+	}
+}
+
+func (m *Manager) parseYaml(configFilename string) error {
+	d, err := readConfig(configFilename)
+	if err != nil {
+		return err
+	}
+	m.configFilename = configFilename
+	m.configModTime = configModTime(configFilename)
+
+	// Assemble m.destinationMap from local copy of Destinations
+	m.applySettings(d)
 	for _, destination := range d.Destinations {
 		m.addDestination(destination)
 	}
+	for _, source := range d.Sources {
+		if err = m.addSource(source); err != nil {
+			return fmt.Errorf("unable to add source from %s: %w", configFilename, err)
+		}
+	}
+	m.refreshSources(true)
 
 	if len(m.destinationMap) == 0 {
 		logger.Warn("No valid pinger destinations from yaml data: use mqtt add topic.")
@@ -101,46 +249,94 @@ func (m *Manager) parseYaml(configFilename string) error {
 	return nil
 }
 
-func (m *Manager) addDestination(destination Destination) {
-	if destination.Addr == "" {
-		logger.Warnf("Ignoring destination, due to no address: %#v", destination)
-		return
+// parseDestinationOptions fills in the runtime fields derived from the configurable
+// ones, other than the pingers
+func (m *Manager) parseDestinationOptions(destination *Destination) error {
+	if destination.IntervalSeconds < 0 {
+		return fmt.Errorf("invalid interval %d", destination.IntervalSeconds)
+	}
+
+	destination.maintenanceWindows = nil
+	for _, window := range destination.Maintenance {
+		mw, err := parseMaintenanceWindow(window)
+		if err != nil {
+			return err
+		}
+		destination.maintenanceWindows = append(destination.maintenanceWindows, mw)
+	}
+
+	destination.activeHours = nil
+	if destination.Schedule != nil {
+		var err error
+		if destination.activeHours, err = parseSchedule(destination.Schedule); err != nil {
+			return err
+		}
 	}
 
-	if destination.Name == "" {
-		destination.Name = destination.Addr
+	// keep IntervalSeconds as configured, so it can be compared with updated configs
+	destination.interval = time.Duration(destination.IntervalSeconds) * time.Second
+	if destination.IntervalSeconds == 0 {
+		destination.interval = time.Duration(m.defaultIntervalSeconds) * time.Second
+	}
+	return nil
+}
+
+// addDestination starts pinging the destination. Problems are logged as well as
+// returned, so callers adding many destinations can just go on.
+func (m *Manager) addDestination(destination Destination) error {
+	destination.Name = destinationName(&destination)
+
+	addrs, err := destination.probeAddrs()
+	if err != nil {
+		logger.Warnf("Ignoring destination, due to %v: %#v", err, destination)
+		return err
 	}
 
 	if _, ok := m.destinationMap[destination.Name]; ok {
 		logger.Warnf("Ignoring duplicate destination name: %s", destination.Name)
-		return
+		return fmt.Errorf("%w: %s", errDuplicate, destination.Name)
 	}
 
-	pinger, err := ping.NewPinger(destination.Addr)
-	if err != nil {
-		logger.Warnf("Ignoring invalid destination %s: %v", destination.Name, err)
-		return
+	if err = m.parseDestinationOptions(&destination); err != nil {
+		logger.Warnf("Ignoring destination %s, due to %v", destination.Name, err)
+		return err
+	}
+	m.restoreState(&destination)
+
+	if destination.activeHours != nil && !destination.activeHours.active(time.Now()) {
+		destination.inactive = true
+		m.destinationMap[destination.Name] = &destination
+		logger.Infof("Added destination %s (outside of its schedule)", destination.Name)
+		m.pauseDestination(&destination)
+		return nil
 	}
-	destination.pinger = pinger
 
-	if destination.IntervalSeconds == 0 {
-		destination.IntervalSeconds = m.defaultIntervalSeconds
+	if err = destination.startProbe(addrs); err != nil {
+		logger.Warnf("Ignoring invalid destination %s: %v", destination.Name, err)
+		return err
 	}
-	destination.pinger.Interval = time.Duration(destination.IntervalSeconds) * time.Second
 
 	m.destinationMap[destination.Name] = &destination
-	logger.Infof("Added destination %s (%s)", destination.Name, pinger.IPAddr().IP.String())
-
-	go func() {
-		if err := destination.pinger.Run(); err != nil {
-			logger.Errorf("Unable to kick off pinger for destination %s: %w", destination.Name, err)
-		}
-	}()
+	logger.Infof("Added destination %s (%s)", destination.Name, destination.ipString())
+	if !m.restoring {
+		// while restoring, this would replace the retained state about to be read back
+		m.publishDestination(&destination)
+	}
+	return nil
 }
 
 func (m *Manager) handleUpdateStatusTick() {
+	if m.restoring {
+		// determining states now would replace the ones about to be read back
+		return
+	}
+	m.applySchedules()
+
 	for _, destination := range m.destinationMap {
-		stats := destination.pinger.Statistics()
+		if !destination.isProbing() {
+			continue
+		}
+		stats := destination.probeStats()
 		isOnline := false
 		packetsSentSinceLastIter := stats.PacketsSent - destination.lastPacketsSent
 
@@ -152,29 +348,33 @@ func (m *Manager) handleUpdateStatusTick() {
 		}
 
 		isOnlineChanged := isOnline != destination.lastIsOnline
+		destination.packetsSent += stats.PacketsSent - destination.lastPacketsSent
+		destination.packetsRecv += stats.PacketsRecv - destination.lastPacketsRecv
 		destination.lastPacketsRecv = stats.PacketsRecv
 		destination.lastPacketsSent = stats.PacketsSent
 		destination.lastIsOnline = isOnline
-
-		logger.Tracef("%s pinger %s sent: %d received: %d (%.0f%% loss) isOnline: %t changed: %t consecOffline: %d",
-			destination.Name, destination.pinger.IPAddr().IP.String(), destination.lastPacketsSent, destination.lastPacketsRecv,
-			stats.PacketLoss, destination.lastIsOnline, isOnlineChanged, destination.consecutiveOfflines)
+		destination.recordStats(time.Now())
 
 		if isOnline {
-			if isOnlineChanged {
-				logger.Infof("%s pinger is now online", destination.Name)
-				m.publishDestination(destination)
-			}
 			destination.consecutiveOfflines = 0
 		} else {
-			// is offline. Notify if this happens 3 times in a row.
+			// is offline. Notify if this happens offlineThreshold times in a row.
 			destination.consecutiveOfflines += 1
-			if destination.consecutiveOfflines == 3 {
-				logger.Infof("%s pinger is now offline", destination.Name)
-				m.publishDestination(destination)
-			}
+		}
+
+		logger.Tracef("%s pinger %s sent: %d received: %d (%.0f%% loss) isOnline: %t changed: %t consecOffline: %d",
+			destination.Name, destination.ipString(), destination.packetsSent, destination.packetsRecv,
+			stats.PacketLoss, destination.lastIsOnline, isOnlineChanged, destination.consecutiveOfflines)
+	}
+
+	// Publish changes only after all destinations are updated, so the state of the
+	// destinations they depend on is current
+	for _, destination := range m.destinationMap {
+		if destination.isProbing() && destination.isDetermined() {
+			m.publishStateChange(destination)
 		}
 	}
+	m.checkOutages(time.Now())
 }
 
 func (m *Manager) msgParseStatus(topic, payload string) {
@@ -204,73 +404,91 @@ func (m *Manager) msgParseConfig(topic, payload string) {
 		logger.Errorf("Unexpected parsing of topic: %s", topic)
 		return
 	}
+	if own, ok := m.ownDestinationMsgs[name]; ok && own == payload {
+		// our own publish coming back, e.g. after a rename; already applied
+		delete(m.ownDestinationMsgs, name)
+		logger.Tracef("Ignoring own publish on %s", topic)
+		return
+	}
 	if payload != "" {
-		m.handleDestinationMsgAdd(name, payload)
+		m.publishResult(name, "add", payload, m.handleDestinationMsgAdd(name, payload))
 	} else {
-		m.handleDestinationMsgDel(name, true)
+		m.publishResult(name, "delete", payload, m.handleDestinationMsgDel(name, true))
 	}
 }
 
-func (m *Manager) handleDestinationMsgAdd(name, payload string) {
-	// replace existing destination by removing existing one
-	m.handleDestinationMsgDel(name, false)
-
-	var destination Destination
+func (m *Manager) handleDestinationMsgAdd(name, payload string) error {
+	destination := Destination{Addr: payload}
 	if json.Valid([]byte(payload)) {
-		var dest destinationJson
-		if err := json.Unmarshal([]byte(payload), &dest); err != nil {
-			logger.Errorf("Unexpected json unmarshal error (%s): %w", payload, err)
-			return
-		}
-		destination = Destination{
-			Name:            name,
-			Addr:            dest.Address,
-			IntervalSeconds: dest.Interval,
+		var err error
+		if destination, err = decodeDestinationJson(payload); err != nil {
+			logger.Warnf("Ignoring destination %s, due to %v", name, err)
+			return err
 		}
-	} else {
-		destination = Destination{
-			Name: name,
-			Addr: payload,
+	}
+	destination.Name = name
+	destination.source = sourceMqtt
+
+	// an existing destination is replaced in place, so it is left as it was if
+	// the replacement is invalid
+	if existing, ok := m.destinationMap[name]; ok {
+		if err := m.updateDestination(existing, destination); err != nil {
+			logger.Warnf("Ignoring replacement of destination %s, due to %v", name, err)
+			return err
 		}
+		existing.source = sourceMqtt
+		return nil
 	}
-	m.addDestination(destination)
+	return m.addDestination(destination)
 }
 
-func (m *Manager) handleDestinationMsgDel(name string, logNotFound bool) {
+func (m *Manager) handleDestinationMsgDel(name string, logNotFound bool) error {
 	destination, ok := m.destinationMap[name]
 	if !ok {
 		if logNotFound {
 			logger.Warnf("Ignoring removal of destination name %s: not-found", name)
 		}
-		return
+		return errNotFound
 	}
 
-	destination.pinger.Stop()
+	destination.stopProbe()
 	delete(m.destinationMap, name)
-	logger.Infof("Removed destination %s (%s)", name, destination.pinger.IPAddr().IP.String())
+	if m.retain {
+		m.clearDestinationTopics(name)
+	}
+	logger.Infof("Removed destination %s (%s)", name, destination.ipString())
+	return nil
 }
 
 func (m *Manager) publishDestination(destination *Destination) {
-	msg := &mqtt_agent.Msg{}
-	msg.Topic, msg.Payload = mqtt_agent.MsgPubAdvState(destination.Name, destination.lastIsOnline)
+	msg := &mqtt_agent.Msg{Retained: m.retain}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubAdvStateValue(destination.Name, destination.currentState())
 	m.mqttPub <- *msg
 
 	destinationState := msg.Payload
-	destinationIP := destination.pinger.IPAddr().String()
+	destinationIP := destination.ipString()
 
 	// https://github.com/tidwall/sjson
-	stats := destination.pinger.Statistics()
+	stats := destination.probeStats()
+	stateSince := ""
+	if !destination.stateSince.IsZero() {
+		stateSince = destination.stateSince.Format(time.RFC3339)
+	}
 	values := map[string]string{
-		"name":                 destination.Name,
-		"address":              destination.Addr,
-		"ip":                   destinationIP,
-		"packets_sent":         fmt.Sprintf("%d", destination.lastPacketsSent),
-		"packets_received":     fmt.Sprintf("%d", destination.lastPacketsRecv),
-		"interval_in_seconds":  fmt.Sprintf("%d", destination.IntervalSeconds),
-		"is_online":            fmt.Sprintf("%t", destination.lastIsOnline),
-		"consecutive_offline":  fmt.Sprintf("%d", destination.consecutiveOfflines),
-		"rtt_in_milliseconds":  fmt.Sprintf("%v", stats.AvgRtt.Milliseconds()),
-		"packets_loss_percent": fmt.Sprintf("%.0f%%", stats.PacketLoss),
+		"name":                           destination.Name,
+		"address":                        destination.displayAddr(),
+		"ip":                             destinationIP,
+		"packets_sent":                   fmt.Sprintf("%d", destination.packetsSent),
+		"packets_received":               fmt.Sprintf("%d", destination.packetsRecv),
+		"interval_in_seconds":            fmt.Sprintf("%d", int(destination.interval.Seconds())),
+		"is_online":                      fmt.Sprintf("%t", destination.lastIsOnline),
+		"state":                          destination.currentState(),
+		"in_maintenance":                 fmt.Sprintf("%t", destination.inMaintenance(time.Now())),
+		"consecutive_offline":            fmt.Sprintf("%d", destination.consecutiveOfflines),
+		"rtt_in_milliseconds":            fmt.Sprintf("%v", stats.AvgRtt.Milliseconds()),
+		"packets_loss_percent":           fmt.Sprintf("%.0f%%", stats.PacketLoss),
+		"packets_loss_percent_last_hour": fmt.Sprintf("%.0f%%", destination.windowLoss()),
+		"state_since":                    stateSince,
 	}
 
 	// Do it once and keep it forever
@@ -310,16 +528,14 @@ func max(a, b int) int {
 func (m *Manager) mainLoop() {
 	defer func() { close(m.StopChan) }()
 	timeout := time.After(1 * time.Hour)
-	var advertiseTick *time.Ticker
-	if m.advertisementsSeconds > 0 {
-		advertiseTick = time.NewTicker(time.Duration(m.advertisementsSeconds) * time.Second)
-		logger.Infof("Advertisements will be sent every: %v seconds", m.advertisementsSeconds)
-	} else {
-		advertiseTick = time.NewTicker(time.Duration(1<<63 - 1)) // approximately 290 years
-	}
-	updateStatusInterval := max(minUpdateStatusIntervalSeconds, m.updateStatusIntervalSeconds)
-	updateStatusTick := time.NewTicker(time.Duration(updateStatusInterval) * time.Second)
-	logger.Infof("Checking for pinger updates every: %v seconds", updateStatusInterval)
+	m.advertiseTick = time.NewTicker(m.advertiseInterval())
+	m.updateStatusTick = time.NewTicker(m.updateStatusInterval())
+	m.logTickers()
+	m.publishSettings()
+	m.publishConfigs()
+	m.publishSchema()
+	refreshTick := time.NewTicker(sourcesCheckSeconds * time.Second)
+	stateSaveTick := time.NewTicker(stateSaveSeconds * time.Second)
 
 	topic, _ := mqtt_agent.MsgPubAdvState("#", true)
 	logger.Infof("For destination status, mqtt subscribe to topic: %s", topic)
@@ -329,6 +545,13 @@ func (m *Manager) mainLoop() {
 	// Listen for Ctrl-C.
 	osSignalChn := make(chan os.Signal, 1)
 	signal.Notify(osSignalChn, os.Interrupt)
+	hupChn := make(chan os.Signal, 1)
+	signal.Notify(hupChn, syscall.SIGHUP)
+
+	var restoreDone <-chan struct{}
+	if m.restoring {
+		restoreDone = restoreWindow(m.subscribed, restoreGraceSeconds*time.Second, restoreMaxSeconds*time.Second)
+	}
 
 	var msg mqtt_agent.Msg
 mgrloop:
@@ -338,46 +561,120 @@ mgrloop:
 			switch msg.Topic {
 			case mqtt_agent.GetTopicSubStatus(msg.Topic):
 				m.msgParseStatus(msg.Topic, msg.Payload)
+			case mqtt_agent.GetTopicSubSet(msg.Topic):
+				m.msgParseSet(msg.Topic, msg.Payload)
 			case mqtt_agent.GetTopicSubConfig(msg.Topic):
 				m.msgParseConfig(msg.Topic, msg.Payload)
+			case mqtt_agent.GetTopicSubSilence(msg.Topic):
+				m.msgParseSilence(msg.Topic, msg.Payload)
+			case mqtt_agent.GetTopicSubPing(msg.Topic):
+				m.msgParsePing(msg.Topic, msg.Payload)
+			case mqtt_agent.GetTopicSubCommand(msg.Topic):
+				m.msgParseCommand(msg.Topic, msg.Payload)
+			case mqtt_agent.GetTopicSubDestinations(msg.Topic):
+				m.msgParseDestinations(msg.Payload)
+			case mqtt_agent.GetTopicSubSettings(msg.Topic):
+				m.msgParseSettings(msg.Payload)
+			case mqtt_agent.GetTopicSubExport(msg.Topic):
+				m.msgParseExport(msg.Payload)
+			case mqtt_agent.GetTopicSubImport(msg.Topic):
+				m.msgParseImport(msg.Payload)
+			case mqtt_agent.GetTopicSubAdvState(msg.Topic), mqtt_agent.GetTopicSubAdvInfo(msg.Topic):
+				m.msgParseRetained(msg)
 			default:
 				logger.Infof("Unhandled: topic %s payload %q...", msg.Topic, mqtt_agent.FirstN(msg.Payload, 10))
 			}
+			m.handleChanges()
 		case <-osSignalChn:
 			break mgrloop
-		case <-advertiseTick.C:
-			m.publishAllDestinations()
-		case <-updateStatusTick.C:
+		case <-hupChn:
+			m.reloadConfig("SIGHUP")
+			m.handleChanges()
+		case <-restoreDone:
+			restoreDone = nil
+			m.doneRestoring()
+		case <-m.advertiseTick.C:
+			if !m.restoring {
+				m.publishAllDestinations()
+			}
+		case <-m.updateStatusTick.C:
 			m.handleUpdateStatusTick()
+		case <-refreshTick.C:
+			m.checkConfigModified()
+			m.refreshSources(false)
+			m.refreshGateways()
+			m.handleChanges()
+		case <-stateSaveTick.C:
+			m.saveState()
 		case <-timeout:
 			logger.Info("manager happy loop")
 		}
 	}
 
 	// closing time
+	m.saveState()
+	if m.persistUnlock != nil {
+		m.persistUnlock()
+	}
 	for _, destination := range m.destinationMap {
 		logger.Tracef("stopping pinger %s", destination.Name)
-		destination.pinger.Stop()
+		destination.stopProbe()
 	}
 	logger.Info("manager main loop is finished")
 }
 
-func Start(mqttPub chan<- mqtt_agent.Msg, mqttSub <-chan mqtt_agent.Msg, config string) (*Manager, error) {
-	mgr := Manager{
+// handleChanges saves and publishes what changed in the destinations, after
+// anything that could have changed them
+func (m *Manager) handleChanges() {
+	m.savePersisted()
+	m.publishConfigs()
+}
+
+func newManager(mqttPub chan<- mqtt_agent.Msg, mqttSub <-chan mqtt_agent.Msg) *Manager {
+	return &Manager{
 		StopChan:                    make(chan struct{}),
 		defaultIntervalSeconds:      defaultIntervalSeconds,
 		updateStatusIntervalSeconds: defaultUpdateStatusIntervalSeconds,
+		dependencyMode:              dependencyModeUnreachable,
 		destinationMap:              make(map[string]*Destination),
+		outages:                     make(map[string]*outage),
+		publishedConfigs:            make(map[string]string),
+		ownDestinationMsgs:          make(map[string]string),
+		burstSlots:                  make(chan struct{}, maxConcurrentBursts),
 		mqttPub:                     mqttPub,
 		mqttSub:                     mqttSub,
 	}
+}
 
-	if err := mgr.parseYaml(config); err != nil {
+func Start(mqttPub chan<- mqtt_agent.Msg, mqttSub <-chan mqtt_agent.Msg, config *Config) (*Manager, error) {
+	mgr := newManager(mqttPub, mqttSub)
+	mgr.persistFilename = config.PersistFilename
+	mgr.stateFilename = config.StateFilename
+	mgr.retain = config.Retain
+	mgr.restoring = config.Retain
+	mgr.subscribed = config.Subscribed
+	mgr.stopRetained = config.StopRetained
+	mgr.watchConfig = config.WatchConfig
+
+	if mgr.persistFilename != "" {
+		unlock, err := lockPersisted(mgr.persistFilename)
+		if err != nil {
+			return nil, err
+		}
+		mgr.persistUnlock = unlock
+	}
+	if err := mgr.loadState(); err != nil {
+		return nil, err
+	}
+	if err := mgr.parseYaml(config.Filename); err != nil {
+		return nil, err
+	}
+	if err := mgr.loadPersisted(); err != nil {
 		return nil, err
 	}
 
 	go mgr.mainLoop()
-	return &mgr, nil
+	return mgr, nil
 }
 
 var gDestinationAttrs []string
@@ -0,0 +1,24 @@
+package manager
+
+import (
+	"os"
+	"testing"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+func TestMain(m *testing.M) {
+	// the manager logs as it goes, so the global logger must exist
+	if err := logger.Init(&logger.Config{LogDir: os.TempDir(), LogDest: logger.LogDestNone}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestManager returns a manager that is not running, and the channel where
+// its mqtt publications end up
+func newTestManager() (*Manager, chan mqtt_agent.Msg) {
+	pub := make(chan mqtt_agent.Msg, 100)
+	return newManager(pub, make(chan mqtt_agent.Msg)), pub
+}
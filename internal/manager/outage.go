@@ -0,0 +1,213 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+const (
+	defaultOutageWindowSeconds   = 60
+	defaultOutageThresholdPct    = 50
+	defaultOutageMinDestinations = 3
+
+	outageGroupAll = "all"
+)
+
+// OutageConfig enables detection of many destinations going offline together
+type OutageConfig struct {
+	WindowSeconds    int `mapstructure:"window"`
+	ThresholdPercent int `mapstructure:"threshold"`
+	MinDestinations  int `mapstructure:"min-destinations"`
+}
+
+// outage is an ongoing correlated outage of a group of destinations
+type outage struct {
+	Group    string   `json:"group"`
+	State    string   `json:"state"`
+	Cause    string   `json:"cause"`
+	Affected []string `json:"affected"`
+	Total    int      `json:"total"`
+	Since    string   `json:"since"`
+}
+
+func (c *OutageConfig) applyDefaults() {
+	if c.WindowSeconds <= 0 {
+		c.WindowSeconds = defaultOutageWindowSeconds
+	}
+	if c.ThresholdPercent <= 0 || c.ThresholdPercent > 100 {
+		c.ThresholdPercent = defaultOutageThresholdPct
+	}
+	if c.MinDestinations <= 0 {
+		c.MinDestinations = defaultOutageMinDestinations
+	}
+}
+
+func (d *Destination) isDown() bool {
+	return d.state == mqtt_agent.StateOffline || d.state == mqtt_agent.StateUnreachable
+}
+
+// outageGroups returns all destinations, plus the destinations of each tag
+func (m *Manager) outageGroups() map[string][]*Destination {
+	groups := make(map[string][]*Destination)
+	for _, destination := range m.destinationMap {
+		groups[outageGroupAll] = append(groups[outageGroupAll], destination)
+		for _, tag := range destination.Tags {
+			groups["tag:"+tag] = append(groups["tag:"+tag], destination)
+		}
+	}
+	return groups
+}
+
+// checkOutages looks for groups where enough destinations went down within the
+// outage window and publishes a single event for them. The outage is resolved
+// once the destinations that are down are below the threshold again.
+func (m *Manager) checkOutages(now time.Time) {
+	if m.outageConfig == nil {
+		return
+	}
+	cfg := m.outageConfig
+	window := time.Duration(cfg.WindowSeconds) * time.Second
+
+	groups := m.outageGroups()
+	for group, members := range groups {
+		var recent, down []*Destination
+		for _, destination := range members {
+			if !destination.isDown() {
+				continue
+			}
+			down = append(down, destination)
+			if now.Sub(destination.downSince) <= window {
+				recent = append(recent, destination)
+			}
+		}
+
+		current, active := m.outages[group]
+		switch {
+		case !active && len(recent) >= cfg.MinDestinations && len(recent)*100 >= cfg.ThresholdPercent*len(members):
+			current = &outage{
+				Group:    group,
+				State:    "active",
+				Cause:    m.outageCause(recent),
+				Affected: destinationNames(recent),
+				Total:    len(members),
+				Since:    now.Format(time.RFC3339),
+			}
+			m.outages[group] = current
+			logger.Infof("Outage of %s: %d of %d destinations down, probable cause: %s",
+				group, len(recent), len(members), current.Cause)
+			m.publishOutage(current)
+		case active && len(down)*100 < cfg.ThresholdPercent*len(members):
+			current.State = "resolved"
+			delete(m.outages, group)
+			logger.Infof("Outage of %s is resolved", group)
+			m.publishOutage(current)
+		}
+	}
+
+	// groups that no longer exist, for example because destinations were removed
+	for group, current := range m.outages {
+		if _, ok := groups[group]; !ok {
+			current.State = "resolved"
+			delete(m.outages, group)
+			m.publishOutage(current)
+		}
+	}
+}
+
+// outageCause guesses what the affected destinations have in common: a destination
+// they all depend on, a gateway destination that is down, or a shared subnet. The
+// gateway is only known from a destination of type gateway.
+func (m *Manager) outageCause(affected []*Destination) string {
+	if parent := commonDependency(affected); parent != "" {
+		return "parent " + parent
+	}
+	for _, destination := range m.destinationMap {
+		if destination.Type == destinationTypeGateway && destination.isDown() {
+			return "gateway " + destination.ipString()
+		}
+	}
+	var ips []net.IP
+	for _, destination := range affected {
+		for _, pinger := range destination.pingers {
+			ips = append(ips, pinger.IPAddr().IP)
+		}
+	}
+	if subnet := commonSubnet(ips); subnet != "" {
+		return "subnet " + subnet
+	}
+	return "unknown"
+}
+
+// commonDependency returns a destination that all the given ones depend on
+func commonDependency(destinations []*Destination) string {
+	if len(destinations) == 0 {
+		return ""
+	}
+	for _, candidate := range destinations[0].DependsOn {
+		shared := true
+		for _, destination := range destinations[1:] {
+			if !slices.Contains(destination.DependsOn, candidate) {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// commonSubnet returns the /24 (IPv4) or /64 (IPv6) that all addresses are part of
+func commonSubnet(ips []net.IP) string {
+	var subnet *net.IPNet
+	for _, ip := range ips {
+		var mask net.IPMask
+		if ip.To4() != nil {
+			ip, mask = ip.To4(), net.CIDRMask(24, 32)
+		} else {
+			mask = net.CIDRMask(64, 128)
+		}
+		network := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		if subnet == nil {
+			subnet = network
+		} else if subnet.String() != network.String() {
+			return ""
+		}
+	}
+	if subnet == nil {
+		return ""
+	}
+	return subnet.String()
+}
+
+func (m *Manager) publishOutage(o *outage) {
+	payload, err := json.Marshal(o)
+	if err != nil {
+		logger.Errorf("Unable to encode outage of %s: %v", o.Group, err)
+		return
+	}
+	msg := mqtt_agent.Msg{}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubOutage(string(payload))
+	m.mqttPub <- msg
+}
+
+func destinationNames(destinations []*Destination) []string {
+	names := make([]string, 0, len(destinations))
+	for _, destination := range destinations {
+		names = append(names, destination.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c OutageConfig) String() string {
+	return fmt.Sprintf("window %ds threshold %d%% min %d", c.WindowSeconds, c.ThresholdPercent, c.MinDestinations)
+}
@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+func TestCommonSubnet(t *testing.T) {
+	ips := []net.IP{net.ParseIP("192.168.1.10"), net.ParseIP("192.168.1.200")}
+	if subnet := commonSubnet(ips); subnet != "192.168.1.0/24" {
+		t.Fatalf("unexpected subnet %q", subnet)
+	}
+
+	ips = append(ips, net.ParseIP("192.168.2.1"))
+	if subnet := commonSubnet(ips); subnet != "" {
+		t.Fatalf("expected no common subnet, got %q", subnet)
+	}
+
+	ips = []net.IP{net.ParseIP("fd00:1::1"), net.ParseIP("fd00:1::ff")}
+	if subnet := commonSubnet(ips); subnet != "fd00:1::/64" {
+		t.Fatalf("unexpected ipv6 subnet %q", subnet)
+	}
+}
+
+func TestCommonDependency(t *testing.T) {
+	destinations := []*Destination{
+		{Name: "tv", DependsOn: []string{"wan", "router"}},
+		{Name: "nas", DependsOn: []string{"router"}},
+	}
+	if parent := commonDependency(destinations); parent != "router" {
+		t.Fatalf("unexpected common dependency %q", parent)
+	}
+
+	destinations = append(destinations, &Destination{Name: "phone"})
+	if parent := commonDependency(destinations); parent != "" {
+		t.Fatalf("expected no common dependency, got %q", parent)
+	}
+}
+
+func TestCheckOutages(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	recently, longAgo := now.Add(-10*time.Second), now.Add(-10*time.Minute)
+
+	// destinations returns n destinations, the first down ones down since downSince
+	destinations := func(prefix string, n, down int, downSince time.Time, tags ...string) []*Destination {
+		var result []*Destination
+		for i := 0; i < n; i++ {
+			destination := &Destination{Name: fmt.Sprintf("%s%d", prefix, i), Tags: tags, state: mqtt_agent.StateOnline}
+			if i < down {
+				destination.state, destination.downSince = mqtt_agent.StateOffline, downSince
+			}
+			result = append(result, destination)
+		}
+		return result
+	}
+
+	for _, tc := range []struct {
+		name         string
+		destinations []*Destination
+		ongoing      []string // groups with an outage already
+		expected     []string // published group and state
+	}{
+		{"down within window", destinations("d", 4, 3, recently), nil, []string{"all active"}},
+		{"down before window", destinations("d", 4, 3, longAgo), nil, nil},
+		{"below threshold", destinations("d", 10, 3, recently), nil, nil},
+		{"below min destinations", destinations("d", 2, 2, recently), nil, nil},
+		{"tag group", append(destinations("lab", 3, 3, recently, "lab"), destinations("d", 7, 0, now)...),
+			nil, []string{"tag:lab active"}},
+		{"still down", destinations("d", 4, 3, longAgo), []string{"all"}, nil},
+		{"resolved", destinations("d", 4, 1, recently), []string{"all"}, []string{"all resolved"}},
+		{"removed group", destinations("d", 4, 0, now), []string{"tag:gone"}, []string{"tag:gone resolved"}},
+	} {
+		m, pub := newTestManager()
+		m.outageConfig = &OutageConfig{}
+		m.outageConfig.applyDefaults()
+		for _, destination := range tc.destinations {
+			m.destinationMap[destination.Name] = destination
+		}
+		for _, group := range tc.ongoing {
+			m.outages[group] = &outage{Group: group, State: "active"}
+		}
+
+		m.checkOutages(now)
+		var published []string
+		for len(pub) > 0 {
+			var event outage
+			if err := json.Unmarshal([]byte((<-pub).Payload), &event); err != nil {
+				t.Fatalf("%s: unexpected outage: %v", tc.name, err)
+			}
+			published = append(published, event.Group+" "+event.State)
+		}
+		if !reflect.DeepEqual(published, tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.expected, published)
+		}
+	}
+}
+
+func TestOutageCause(t *testing.T) {
+	m, _ := newTestManager()
+	affected := []*Destination{{Name: "tv", DependsOn: []string{"router"}}, {Name: "nas", DependsOn: []string{"router"}}}
+	if cause := m.outageCause(affected); cause != "parent router" {
+		t.Fatalf("unexpected cause %q", cause)
+	}
+
+	affected[1].DependsOn = nil
+	if cause := m.outageCause(affected); cause != "unknown" {
+		t.Fatalf("unexpected cause %q", cause)
+	}
+	// the gateway is only known from a gateway destination that is down
+	m.destinationMap["gateway"] = &Destination{Name: "gateway", Type: destinationTypeGateway, state: mqtt_agent.StateOffline}
+	if cause := m.outageCause(affected); !strings.HasPrefix(cause, "gateway") {
+		t.Fatalf("unexpected cause %q", cause)
+	}
+}
@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/antigloss/go/logger"
+	"gopkg.in/yaml.v3"
+)
+
+var errLocked = errors.New("in use by a running instance")
+
+// lockPersisted locks the persisted destinations, so that a running instance and
+// an import do not overwrite each other's changes
+func lockPersisted(filename string) (unlock func(), err error) {
+	unlock, err = lockFile(filename + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("persisted destinations %s: %w", filename, err)
+	}
+	return unlock, nil
+}
+
+// IsYamlFile tells whether a file is written as yaml instead of json, based on its extension
+func IsYamlFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// encodeDestinations returns the destinations in the format of the destinations
+// topic, as json or yaml
+func encodeDestinations(entries []destinationSyncJson, asYaml bool) ([]byte, error) {
+	return encodeDocument(entries, asYaml)
+}
+
+// encodeDocument encodes the value as indented json, or as yaml with the same keys
+func encodeDocument(value interface{}, asYaml bool) ([]byte, error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil || !asYaml {
+		return data, err
+	}
+	// go through json, so yaml uses the same keys
+	var generic interface{}
+	if err = json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+// decodeDocument decodes json, or yaml, into value
+func decodeDocument(data []byte, asYaml bool, value interface{}) error {
+	if asYaml {
+		return yaml.Unmarshal(data, value)
+	}
+	return json.Unmarshal(data, value)
+}
+
+func decodeDestinations(data []byte, asYaml bool) ([]Destination, error) {
+	var entries []interface{}
+	if err := decodeDocument(data, asYaml, &entries); err != nil {
+		return nil, err
+	}
+	return decodeDestinationList(entries)
+}
+
+// decodeDestinationList decodes the elements of a list of destinations, as added via mqtt
+func decodeDestinationList(entries []interface{}) ([]Destination, error) {
+	destinations := make([]Destination, 0, len(entries))
+	for i, entry := range entries {
+		destination, err := decodeDestination(entry)
+		if err != nil {
+			return nil, fmt.Errorf("destination #%d: %w", i, err)
+		}
+		destination.source = sourceMqtt
+		destinations = append(destinations, destination)
+	}
+	return destinations, nil
+}
+
+// runtimeDestinations returns the destinations added via mqtt, sorted by name
+func (m *Manager) runtimeDestinations() []destinationSyncJson {
+	entries := []destinationSyncJson{}
+	for _, destination := range m.destinationMap {
+		if destination.source == sourceMqtt {
+			entries = append(entries, destinationSyncJson{Name: destination.Name, destinationJson: destination.toJson()})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// loadPersisted adds the destinations saved by a previous run. A missing file is
+// not an error, since it is only written once there are changes.
+func (m *Manager) loadPersisted() error {
+	if m.persistFilename == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.persistFilename)
+	if os.IsNotExist(err) {
+		logger.Infof("No persisted destinations in %s yet", m.persistFilename)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open persisted destinations %s: %w", m.persistFilename, err)
+	}
+	destinations, err := decodeDestinations(data, IsYamlFile(m.persistFilename))
+	if err != nil {
+		return fmt.Errorf("unable to parse persisted destinations %s: %w", m.persistFilename, err)
+	}
+	for _, destination := range destinations {
+		m.addDestination(destination)
+	}
+	logger.Infof("Loaded %d persisted destinations from %s", len(destinations), m.persistFilename)
+
+	// destinations that could not be added are kept out of the file from now on
+	m.persisted, _ = encodeDestinations(m.runtimeDestinations(), IsYamlFile(m.persistFilename))
+	return nil
+}
+
+// savePersisted writes the destinations added via mqtt, if they changed since
+// they were last written. The file is replaced atomically.
+func (m *Manager) savePersisted() {
+	if m.persistFilename == "" {
+		return
+	}
+	data, err := encodeDestinations(m.runtimeDestinations(), IsYamlFile(m.persistFilename))
+	if err != nil {
+		logger.Errorf("Unable to encode persisted destinations: %v", err)
+		return
+	}
+	if string(data) == string(m.persisted) {
+		return
+	}
+
+	if err = writeFileAtomic(m.persistFilename, data); err != nil {
+		logger.Errorf("Unable to save persisted destinations %s: %v", m.persistFilename, err)
+		return
+	}
+	m.persisted = data
+	logger.Infof("Saved persisted destinations to %s", m.persistFilename)
+}
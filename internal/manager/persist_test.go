@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDestinations(t *testing.T) {
+	entries := []destinationSyncJson{
+		{Name: "nas", destinationJson: destinationJson{Address: "192.168.1.5", Interval: 10, DependsOn: []string{"router"}}},
+		{Name: "tv", destinationJson: destinationJson{Address: "192.168.1.6", Schedule: &Schedule{Hours: []string{"08:00-18:00"}}}},
+	}
+	for _, asYaml := range []bool{false, true} {
+		data, err := encodeDestinations(entries, asYaml)
+		if err != nil {
+			t.Fatalf("unexpected error (yaml %t): %v", asYaml, err)
+		}
+		decoded, err := decodeDestinations(data, asYaml)
+		if err != nil || len(decoded) != len(entries) {
+			t.Fatalf("round trip (yaml %t) got %+v, %v:\n%s", asYaml, decoded, err, data)
+		}
+		for i := range decoded {
+			if decoded[i].Name != entries[i].Name || !reflect.DeepEqual(decoded[i].toJson(), entries[i].destinationJson) {
+				t.Fatalf("round trip (yaml %t) got %+v:\n%s", asYaml, decoded[i], data)
+			}
+		}
+	}
+}
+
+func TestSavePersisted(t *testing.T) {
+	m, _ := newTestManager()
+	m.persistFilename = filepath.Join(t.TempDir(), "destinations.yaml")
+	m.destinationMap["router"] = &Destination{Name: "router", Addr: "192.168.1.1", source: sourceYaml}
+	m.destinationMap["nas"] = &Destination{Name: "nas", Addr: "192.168.1.5", source: sourceMqtt}
+
+	m.savePersisted()
+	data, err := os.ReadFile(m.persistFilename)
+	if err != nil {
+		t.Fatalf("expected file to be written: %v", err)
+	}
+	entries, err := decodeDestinations(data, true)
+	if err != nil || len(entries) != 1 || entries[0].Name != "nas" {
+		t.Fatalf("expected only runtime destinations, got %+v, %v", entries, err)
+	}
+
+	// unchanged destinations are not written again
+	if err = os.Remove(m.persistFilename); err != nil {
+		t.Fatal(err)
+	}
+	m.savePersisted()
+	if _, err = os.Stat(m.persistFilename); !os.IsNotExist(err) {
+		t.Fatal("expected no write without changes")
+	}
+}
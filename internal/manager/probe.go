@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+	"github.com/go-ping/ping"
+)
+
+const (
+	destinationTypePing     = "ping"
+	destinationTypeGateway  = "gateway"
+	destinationTypeInternet = "internet"
+)
+
+// defaultInternetTargets are used by an internet destination that has no targets
+var defaultInternetTargets = []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"}
+
+// probeStats is the aggregate of the statistics of all pingers of a destination.
+// A composite destination counts as sent the most any of its pingers sent and as
+// received the sum of all replies, so any target that responds makes it online.
+type probeStats struct {
+	PacketsSent int
+	PacketsRecv int
+	PacketLoss  float64
+	AvgRtt      time.Duration
+}
+
+// probeAddrs returns the addresses that need to be pinged for the destination
+func (d *Destination) probeAddrs() ([]string, error) {
+	switch d.Type {
+	case "", destinationTypePing:
+		if d.Addr == "" {
+			return nil, fmt.Errorf("no address")
+		}
+		return []string{d.Addr}, nil
+	case destinationTypeGateway:
+		gateway, err := defaultGateway()
+		if err != nil {
+			return nil, err
+		}
+		return []string{gateway}, nil
+	case destinationTypeInternet:
+		if len(d.Targets) == 0 {
+			return defaultInternetTargets, nil
+		}
+		return d.Targets, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", d.Type)
+}
+
+// startProbe creates and runs the pingers for the destination
+func (d *Destination) startProbe(addrs []string) error {
+	pingers := make([]*ping.Pinger, 0, len(addrs))
+	for _, addr := range addrs {
+		pinger, err := ping.NewPinger(addr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", addr, err)
+		}
+		pinger.Interval = d.interval
+		pingers = append(pingers, pinger)
+	}
+
+	d.pingers = pingers
+	d.targetAddrs = addrs
+	d.lastPacketsSent = 0
+	d.lastPacketsRecv = 0
+
+	for _, pinger := range pingers {
+		go func(pinger *ping.Pinger) {
+			if err := pinger.Run(); err != nil {
+				logger.Errorf("Unable to kick off pinger %s for destination %s: %v", pinger.Addr(), d.Name, err)
+			}
+		}(pinger)
+	}
+	return nil
+}
+
+func (d *Destination) stopProbe() {
+	for _, pinger := range d.pingers {
+		pinger.Stop()
+	}
+}
+
+func (d *Destination) probeStats() probeStats {
+	var stats probeStats
+	var totalSent, rttCount int
+	var rttSum time.Duration
+	for _, pinger := range d.pingers {
+		s := pinger.Statistics()
+		if s.PacketsSent > stats.PacketsSent {
+			stats.PacketsSent = s.PacketsSent
+		}
+		stats.PacketsRecv += s.PacketsRecv
+		totalSent += s.PacketsSent
+		if s.PacketsRecv > 0 {
+			rttSum += s.AvgRtt
+			rttCount++
+		}
+	}
+	if totalSent > 0 {
+		stats.PacketLoss = float64(totalSent-stats.PacketsRecv) / float64(totalSent) * 100
+	}
+	if rttCount > 0 {
+		stats.AvgRtt = rttSum / time.Duration(rttCount)
+	}
+	return stats
+}
+
+// ipString returns the resolved addresses being pinged, comma separated
+func (d *Destination) ipString() string {
+	ips := make([]string, 0, len(d.pingers))
+	for _, pinger := range d.pingers {
+		ips = append(ips, pinger.IPAddr().String())
+	}
+	return strings.Join(ips, ",")
+}
+
+// displayAddr is the address shown for the destination, which for gateway and
+// internet destinations is what is currently being pinged
+func (d *Destination) displayAddr() string {
+	if d.Addr != "" {
+		return d.Addr
+	}
+	return strings.Join(d.targetAddrs, ",")
+}
+
+// isProbing tells whether the destination pingers should be running. A destination
+// is not pinged while outside of its schedule or when paused by a command.
+func (d *Destination) isProbing() bool {
+	return !d.inactive && !d.paused
+}
+
+// pausedState is the state published for a destination that is not being pinged
+func (d *Destination) pausedState() string {
+	if d.paused {
+		return mqtt_agent.StatePaused
+	}
+	return mqtt_agent.StateInactive
+}
+
+// updateProbing starts or stops the pingers of the destination after one of the
+// reasons for not pinging it changed
+func (m *Manager) updateProbing(destination *Destination, wasProbing bool) {
+	switch {
+	case !wasProbing && destination.isProbing():
+		m.resumeDestination(destination)
+	case !destination.isProbing() && (wasProbing || destination.state != destination.pausedState()):
+		m.pauseDestination(destination)
+	}
+}
+
+// pauseDestination stops pinging the destination and publishes it as paused or inactive
+func (m *Manager) pauseDestination(destination *Destination) {
+	destination.stopProbe()
+	destination.setState(destination.pausedState())
+	destination.downSince = time.Time{}
+	logger.Infof("%s pinger is now %s", destination.Name, destination.state)
+	m.publishDestination(destination)
+}
+
+// resumeDestination starts pinging the destination again. It is published as
+// unknown until its state is determined, like a newly added destination.
+func (m *Manager) resumeDestination(destination *Destination) {
+	addrs, err := destination.probeAddrs()
+	if err == nil {
+		err = destination.startProbe(addrs)
+	}
+	if err != nil {
+		logger.Errorf("Unable to resume pinger for destination %s: %v", destination.Name, err)
+		return
+	}
+	destination.setState("")
+	destination.lastIsOnline = false
+	destination.consecutiveOfflines = 0
+	logger.Infof("%s pinger is resumed", destination.Name)
+	m.publishDestination(destination)
+}
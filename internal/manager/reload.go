@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+// reloadResultJson is what gets published on the reload topic
+type reloadResultJson struct {
+	Config string `json:"config"`
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+	syncSummary
+}
+
+// configModTime returns when the config, or any of the files it includes, was last
+// modified, or the zero time if it cannot be told
+func configModTime(configFilename string) time.Time {
+	if configFilename == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(configFilename)
+	if err != nil {
+		return time.Time{}
+	}
+	modTime := info.ModTime()
+	filenames, _ := configFiles(configFilename)
+	for _, filename := range filenames {
+		if info, err = os.Stat(filename); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime
+}
+
+// fromYaml tells whether a destination is managed by the config yaml
+func fromYaml(destination *Destination) bool {
+	return destination.source == sourceYaml
+}
+
+// checkConfigModified reloads the config when watching it and its file changed
+func (m *Manager) checkConfigModified() {
+	if !m.watchConfig || m.configFilename == "" {
+		return
+	}
+	modTime := configModTime(m.configFilename)
+	if modTime.IsZero() || modTime.Equal(m.configModTime) {
+		return
+	}
+	m.reloadConfig("modified")
+}
+
+// reloadConfig reads the config yaml again and applies the differences: destinations
+// that did not change keep their pingers and counters. If the config cannot be used,
+// nothing changes.
+func (m *Manager) reloadConfig(reason string) {
+	result := reloadResultJson{Config: m.configFilename, Reason: reason,
+		syncSummary: syncSummary{Added: []string{}, Updated: []string{}, Removed: []string{}}}
+	if m.configFilename == "" {
+		logger.Warn("Ignoring reload: no config yaml file provided")
+		return
+	}
+	m.configModTime = configModTime(m.configFilename)
+
+	d, err := readConfig(m.configFilename)
+	if err == nil && len(d.skipped) != 0 {
+		// applying the rest would remove the running destinations of the skipped ones
+		err = fmt.Errorf("invalid destinations: %s", strings.Join(d.skipped, "; "))
+	}
+	if err == nil {
+		err = m.reloadSources(d.Sources)
+	}
+	if err != nil {
+		logger.Errorf("Ignoring reload of %s: %v", m.configFilename, err)
+		result.Error = err.Error()
+		m.publishReloadResult(&result)
+		return
+	}
+
+	m.applySettings(d)
+	m.resetTickers()
+	m.applyDefaultInterval()
+	m.publishSettings()
+
+	result.syncSummary = *m.syncDestinations(d.Destinations, fromYaml)
+	m.refreshSources(true)
+	logger.Infof("Reloaded %s (%s): %s", m.configFilename, reason, &result.syncSummary)
+	m.publishReloadResult(&result)
+}
+
+// reloadSources replaces the sources, removing the destinations of the ones that
+// are gone. The sources that remain are read again by the next refresh.
+func (m *Manager) reloadSources(sources []Source) error {
+	oldSources := m.sources
+	m.sources = nil
+	for _, source := range sources {
+		if err := m.addSource(source); err != nil {
+			m.sources = oldSources
+			return err
+		}
+	}
+
+	ids := make(map[string]bool, len(m.sources))
+	for _, source := range m.sources {
+		ids[source.id()] = true
+	}
+	for name, destination := range m.destinationMap {
+		if strings.HasPrefix(destination.source, "file:") && !ids[destination.source] {
+			m.handleDestinationMsgDel(name, false)
+		}
+	}
+	return nil
+}
+
+// applyDefaultInterval restarts the pingers of destinations without an interval of
+// their own, when the default one changed
+func (m *Manager) applyDefaultInterval() {
+	interval := time.Duration(m.defaultIntervalSeconds) * time.Second
+	for _, destination := range m.destinationMap {
+		if destination.IntervalSeconds != 0 || destination.interval == interval {
+			continue
+		}
+		destination.interval = interval
+		if destination.isProbing() {
+			destination.stopProbe()
+			if err := destination.startProbe(destination.targetAddrs); err != nil {
+				logger.Errorf("Unable to restart pinger for destination %s: %v", destination.Name, err)
+			}
+		}
+	}
+}
+
+func (m *Manager) publishReloadResult(result *reloadResultJson) {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("Unable to encode reload result: %v", err)
+		return
+	}
+	msg := mqtt_agent.Msg{}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubReload(string(payload))
+	m.mqttPub <- msg
+}
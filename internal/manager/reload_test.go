@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	configFilename := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(config string) {
+		if err := os.WriteFile(configFilename, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(`
+destinations:
+  - {name: keep, address: 127.0.0.1}
+  - {name: change, address: 127.0.0.1}
+  - {name: drop, address: 127.0.0.1}
+`)
+
+	m, pub := newTestManager()
+	defer func() {
+		for _, destination := range m.destinationMap {
+			destination.stopProbe()
+		}
+	}()
+	if err := m.parseYaml(configFilename); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.addDestination(Destination{Name: "runtime", Addr: "127.0.0.1", source: sourceMqtt})
+	keep := m.destinationMap["keep"]
+	keep.packetsSent = 10
+
+	writeConfig(`
+dependency-mode: suppress
+destinations:
+  - {name: keep, address: 127.0.0.1}
+  - {name: change, address: 127.0.0.1, interval: 30}
+  - {name: new, address: 127.0.0.1}
+`)
+	for len(pub) > 0 {
+		<-pub
+	}
+	m.reloadConfig("test")
+
+	if m.destinationMap["keep"] != keep || keep.packetsSent != 10 {
+		t.Fatal("expected unchanged destination to be kept as is")
+	}
+	if _, ok := m.destinationMap["runtime"]; !ok {
+		t.Fatal("expected destination added via mqtt to be kept")
+	}
+	if m.dependencyMode != dependencyModeSuppress {
+		t.Fatalf("expected settings to be applied, got %s", m.dependencyMode)
+	}
+
+	var result reloadResultJson
+	for len(pub) > 0 {
+		msg := <-pub
+		if err := json.Unmarshal([]byte(msg.Payload), &result); err == nil && result.Reason == "test" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(result.Added, []string{"new"}) ||
+		!reflect.DeepEqual(result.Updated, []string{"change"}) || !reflect.DeepEqual(result.Removed, []string{"drop"}) {
+		t.Fatalf("unexpected reload result %+v", result)
+	}
+
+	// an invalid config changes nothing
+	writeConfig("dependency-mode: bogus\n")
+	m.reloadConfig("test")
+	if len(m.destinationMap) != 4 || m.dependencyMode != dependencyModeSuppress {
+		t.Fatal("expected invalid config to be ignored")
+	}
+}
+
+func TestReloadConfigWithInvalidDestination(t *testing.T) {
+	configFilename := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(config string) {
+		if err := os.WriteFile(configFilename, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(`
+destinations:
+  - {name: nas, address: 127.0.0.1}
+  - {name: tv, address: 127.0.0.1}
+`)
+
+	m, pub := newTestManager()
+	defer func() {
+		for _, destination := range m.destinationMap {
+			destination.stopProbe()
+		}
+	}()
+	if err := m.parseYaml(configFilename); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nas := m.destinationMap["nas"]
+	nas.packetsSent = 10
+
+	// a typo in one destination must not remove the running one
+	writeConfig(`
+destinations:
+  - {name: nas, adress: 127.0.0.1}
+  - {name: tv, address: 127.0.0.1, interval: 30}
+`)
+	for len(pub) > 0 {
+		<-pub
+	}
+	m.reloadConfig("test")
+
+	if m.destinationMap["nas"] != nas || nas.packetsSent != 10 {
+		t.Fatal("expected the destination with an invalid entry to be kept as is")
+	}
+	if m.destinationMap["tv"].IntervalSeconds != 0 {
+		t.Fatal("expected the reload to change nothing")
+	}
+	var result reloadResultJson
+	for len(pub) > 0 {
+		msg := <-pub
+		if err := json.Unmarshal([]byte(msg.Payload), &result); err == nil && result.Reason == "test" {
+			break
+		}
+	}
+	if !strings.Contains(result.Error, "adress") {
+		t.Fatalf("expected the invalid destination in the reload error, got %+v", result)
+	}
+}
@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+// Codes of the result of a command
+const (
+	resultOk        = "ok"
+	resultInvalid   = "invalid"
+	resultNotFound  = "not_found"
+	resultDuplicate = "duplicate"
+)
+
+var (
+	errNotFound  = errors.New("not-found")
+	errDuplicate = errors.New("duplicate destination name")
+)
+
+// resultJson is what gets published on the result topic of a destination, for
+// every command about it
+type resultJson struct {
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	RequestId string `json:"request_id,omitempty"`
+	Code      string `json:"code"`
+	Error     string `json:"error,omitempty"`
+}
+
+func resultCode(err error) string {
+	switch {
+	case err == nil:
+		return resultOk
+	case errors.Is(err, errNotFound):
+		return resultNotFound
+	case errors.Is(err, errDuplicate):
+		return resultDuplicate
+	}
+	return resultInvalid
+}
+
+// requestId returns the request_id of a json payload, so its sender can tell
+// which result is for it
+func requestId(payload string) string {
+	if !strings.HasPrefix(strings.TrimSpace(payload), "{") {
+		return ""
+	}
+	var req struct {
+		RequestId string `json:"request_id"`
+	}
+	_ = json.Unmarshal([]byte(payload), &req)
+	return req.RequestId
+}
+
+func (m *Manager) publishResult(name, action, payload string, err error) {
+	result := resultJson{Name: name, Action: action, RequestId: requestId(payload), Code: resultCode(err)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("Unable to encode result for destination %s: %v", name, err)
+		return
+	}
+	msg := mqtt_agent.Msg{}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubResult(name, string(data))
+	m.mqttPub <- msg
+}
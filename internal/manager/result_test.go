@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestResultCode(t *testing.T) {
+	for err, want := range map[error]string{
+		nil:                                resultOk,
+		errNotFound:                        resultNotFound,
+		fmt.Errorf("%w: tv", errDuplicate): resultDuplicate,
+		fmt.Errorf("invalid interval: -1"): resultInvalid,
+	} {
+		if got := resultCode(err); got != want {
+			t.Fatalf("unexpected code for %v: %s", err, got)
+		}
+	}
+	if got := requestId(`{"action":"pause","request_id":"r1"}`); got != "r1" {
+		t.Fatalf("unexpected request id: %q", got)
+	}
+	if got := requestId("pause"); got != "" {
+		t.Fatalf("unexpected request id: %q", got)
+	}
+}
+
+func TestCommandResults(t *testing.T) {
+	m, pub := newTestManager()
+	m.destinationMap["tv"] = &Destination{Name: "tv", inactive: true, state: "inactive"}
+
+	for _, tc := range []struct {
+		topic, payload string
+		result         resultJson
+	}{
+		{"mqtt2ping/command/nas", `{"action":"pause","request_id":"r1"}`,
+			resultJson{Name: "nas", Action: "pause", RequestId: "r1", Code: resultNotFound, Error: "not-found"}},
+		{"mqtt2ping/command/tv", "jump",
+			resultJson{Name: "tv", Action: "jump", Code: resultInvalid, Error: `unknown action "jump"`}},
+		{"mqtt2ping/command/tv", "{", resultJson{Name: "tv", Action: "command", Code: resultInvalid}},
+		{"mqtt2ping/command/tv", `{"action":"pause","request_id":"r2"}`,
+			resultJson{Name: "tv", Action: "pause", RequestId: "r2", Code: resultOk}},
+	} {
+		m.msgParseCommand(tc.topic, tc.payload)
+		var msg = <-pub
+		for len(pub) > 0 {
+			// state and info of the destination come first
+			msg = <-pub
+		}
+		if msg.Topic != "result/"+tc.result.Name || msg.Retained {
+			t.Fatalf("unexpected result message: %+v", msg)
+		}
+		var result resultJson
+		if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+			t.Fatalf("unexpected result %s: %v", msg.Payload, err)
+		}
+		if tc.result.Error == "" && result.Code != resultOk {
+			tc.result.Error = result.Error // the json error message is not checked
+		}
+		if result != tc.result {
+			t.Fatalf("unexpected result for %s: %+v", tc.payload, result)
+		}
+	}
+
+	m.msgParseConfig("mqtt2ping/destination/nas", "")
+	if msg := <-pub; msg.Payload != `{"name":"nas","action":"delete","code":"not_found","error":"not-found"}` {
+		t.Fatalf("unexpected result of delete: %s", msg.Payload)
+	}
+}
@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+const (
+	// restoreGraceSeconds is how long retained messages are read back after subscribing
+	restoreGraceSeconds = 3
+	// restoreMaxSeconds is how long to wait for the broker before giving up on restoring
+	restoreMaxSeconds = 120
+)
+
+// restoreWindow returns a channel that is closed when restoring from retained
+// messages is over: a grace period after subscribed is closed, since the broker
+// sends the retained messages right after the subscription, or at the deadline
+// if the broker is not reached by then.
+func restoreWindow(subscribed <-chan struct{}, grace, deadline time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		deadlineTimer := time.NewTimer(deadline)
+		defer deadlineTimer.Stop()
+		select {
+		case <-subscribed:
+		case <-deadlineTimer.C:
+			logger.Warnf("Not subscribed after %v, giving up on restoring from retained messages", deadline)
+			return
+		}
+		select {
+		case <-time.After(grace):
+		case <-deadlineTimer.C:
+		}
+	}()
+	return done
+}
+
+// doneRestoring publishes the destinations, with their restored state, once the
+// retained messages were read back
+func (m *Manager) doneRestoring() {
+	if !m.restoring {
+		return
+	}
+	m.restoring = false
+	logger.Infof("Done restoring from retained messages")
+	if m.stopRetained != nil {
+		m.stopRetained()
+	}
+	m.publishAllDestinations()
+}
+
+// restorableState tells whether a state read back from the state topic can be
+// used as the last state of a destination. The ones about not being pinged are
+// derived from the config and commands instead.
+func restorableState(state string) bool {
+	switch state {
+	case mqtt_agent.StateOnline, mqtt_agent.StateOffline, mqtt_agent.StateUnreachable, mqtt_agent.StateMaintenance:
+		return true
+	}
+	return false
+}
+
+// parseRetainedInfo applies the counters of a payload of the info topic. All its
+// values are strings.
+func parseRetainedInfo(payload string, saved *destinationStateJson) error {
+	var info map[string]string
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		return err
+	}
+	if isOnline, err := strconv.ParseBool(info["is_online"]); err == nil {
+		saved.IsOnline = isOnline
+	}
+	if restorableState(info["state"]) {
+		saved.State = info["state"]
+		if since, err := time.Parse(time.RFC3339, info["state_since"]); err == nil {
+			saved.StateSince = since
+		}
+	}
+	if n, err := strconv.Atoi(info["packets_sent"]); err == nil {
+		saved.PacketsSent = n
+	}
+	if n, err := strconv.Atoi(info["packets_received"]); err == nil {
+		saved.PacketsReceived = n
+	}
+	if n, err := strconv.Atoi(info["consecutive_offline"]); err == nil {
+		saved.ConsecutiveOffline = n
+	}
+	return nil
+}
+
+// seedState updates the saved state of a destination with what seed reads from a
+// retained message, and restores it right away if the destination already exists
+func (m *Manager) seedState(name string, seed func(*destinationStateJson) error) {
+	saved, ok := m.savedStates[name]
+	destination, exists := m.destinationMap[name]
+	if !ok && exists {
+		saved = destination.savedState(time.Now())
+	}
+	if err := seed(&saved); err != nil {
+		logger.Warnf("Ignoring retained state of destination %s: %v", name, err)
+		return
+	}
+	if saved.SavedAt.IsZero() {
+		saved.SavedAt = time.Now()
+	}
+	if m.savedStates == nil {
+		m.savedStates = make(map[string]destinationStateJson)
+	}
+	m.savedStates[name] = saved
+	if exists {
+		m.restoreState(destination)
+	}
+}
+
+// msgParseRetained seeds the state of destinations from what was published before
+// a restart. Only retained messages received while restoring, right after
+// subscribing, are used; the others are just our own publishes.
+func (m *Manager) msgParseRetained(msg mqtt_agent.Msg) {
+	if !msg.Retained || !m.restoring || msg.Payload == "" {
+		logger.Tracef("Ignoring own publish on %s", msg.Topic)
+		return
+	}
+	if name, ok := mqtt_agent.GetTopicSubDestinationAdvState(msg.Topic); ok {
+		m.seedState(name, func(saved *destinationStateJson) error {
+			if restorableState(msg.Payload) {
+				saved.State = msg.Payload
+				saved.IsOnline = msg.Payload == mqtt_agent.StateOnline
+			}
+			return nil
+		})
+		return
+	}
+	if name, ok := mqtt_agent.GetTopicSubDestinationAdvInfo(msg.Topic); ok {
+		m.seedState(name, func(saved *destinationStateJson) error {
+			return parseRetainedInfo(msg.Payload, saved)
+		})
+		return
+	}
+	logger.Errorf("Unexpected parsing of topic: %s", msg.Topic)
+}
@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+func TestMsgParseRetained(t *testing.T) {
+	m, _ := newTestManager()
+	m.restoring = true
+	nas := &Destination{Name: "nas"}
+	m.destinationMap[nas.Name] = nas
+
+	stateTopic, infoTopic := "mqtt2ping/state/nas", "mqtt2ping/info/nas"
+	m.msgParseRetained(mqtt_agent.Msg{Topic: stateTopic, Payload: "offline", Retained: true})
+	m.msgParseRetained(mqtt_agent.Msg{Topic: infoTopic, Retained: true,
+		Payload: `{"consecutive_offline":"7","is_online":"false","packets_received":"3","packets_sent":"12","state":"offline"}`})
+	if nas.state != "offline" || nas.lastIsOnline || nas.consecutiveOfflines != 7 || nas.packetsSent != 12 || nas.packetsRecv != 3 {
+		t.Fatalf("unexpected seeded destination: %+v", nas)
+	}
+
+	// destinations added later get their state when added
+	m.msgParseRetained(mqtt_agent.Msg{Topic: "mqtt2ping/state/tv", Payload: "online", Retained: true})
+	tv := &Destination{Name: "tv"}
+	m.restoreState(tv)
+	if tv.state != "online" || !tv.lastIsOnline {
+		t.Fatalf("unexpected seeded destination: %+v", tv)
+	}
+
+	// own publishes, not retained, and anything after restoring are ignored
+	m.msgParseRetained(mqtt_agent.Msg{Topic: stateTopic, Payload: "online"})
+	m.restoring = false
+	m.msgParseRetained(mqtt_agent.Msg{Topic: stateTopic, Payload: "online", Retained: true})
+	if nas.state != "offline" {
+		t.Fatalf("expected state to be left alone, got %s", nas.state)
+	}
+}
+
+func TestRestorableState(t *testing.T) {
+	for state, expected := range map[string]bool{
+		"online": true, "unreachable": true, "paused": false, "inactive": false, "bogus": false,
+	} {
+		if restorableState(state) != expected {
+			t.Fatalf("restorableState(%q) != %t", state, expected)
+		}
+	}
+}
+
+func TestRestoreWindow(t *testing.T) {
+	// a late broker: restoring lasts until a grace period after subscribing
+	subscribed := make(chan struct{})
+	done := restoreWindow(subscribed, 20*time.Millisecond, time.Second)
+	select {
+	case <-done:
+		t.Fatal("restoring ended before subscribing")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(subscribed)
+	select {
+	case <-done:
+		t.Fatal("restoring ended without a grace period")
+	case <-time.After(5 * time.Millisecond):
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("restoring did not end after subscribing")
+	}
+
+	// no broker: restoring ends at the deadline
+	done = restoreWindow(make(chan struct{}), 20*time.Millisecond, 30*time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("restoring did not end at the deadline")
+	}
+}
+
+func TestStatusUpdateWhileRestoring(t *testing.T) {
+	m, pub := newTestManager()
+	m.restoring = true
+	m.destinationMap["tv"] = &Destination{Name: "tv", state: "online", lastIsOnline: true}
+
+	m.handleUpdateStatusTick()
+	if !m.restoring || len(pub) != 0 {
+		t.Fatalf("expected status update to wait for restoring, got %d messages", len(pub))
+	}
+	stopped := 0
+	m.stopRetained = func() { stopped++ }
+	m.doneRestoring()
+	if m.restoring || len(pub) != 2 {
+		t.Fatalf("expected destinations published once restored, got %d messages", len(pub))
+	}
+	m.doneRestoring()
+	if stopped != 1 {
+		t.Fatalf("expected to stop reading retained messages once, got %d", stopped)
+	}
+}
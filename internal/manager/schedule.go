@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule limits when a destination is pinged. Outside of it the destination is
+// paused and published as inactive. Hours are ranges like "08:00-18:00"; a range
+// that ends before it starts runs past midnight and belongs to the day it started.
+type Schedule struct {
+	Days     []string `mapstructure:"days" json:"days,omitempty"`
+	Hours    []string `mapstructure:"hours" json:"hours,omitempty"`
+	Timezone string   `mapstructure:"timezone" json:"timezone,omitempty"`
+}
+
+// activeHours is the parsed form of a Schedule
+type activeHours struct {
+	days     [7]bool
+	ranges   [][2]int // minutes since midnight, [from, to)
+	location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseSchedule(s *Schedule) (*activeHours, error) {
+	a := &activeHours{location: time.Local}
+	if len(s.Days) == 0 {
+		for i := range a.days {
+			a.days[i] = true
+		}
+	}
+	for _, day := range s.Days {
+		weekday, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+		if !ok {
+			return nil, fmt.Errorf("schedule has invalid day %q", day)
+		}
+		a.days[weekday] = true
+	}
+
+	if len(s.Hours) == 0 {
+		a.ranges = [][2]int{{0, 24 * 60}}
+	}
+	for _, hours := range s.Hours {
+		bounds := strings.SplitN(hours, "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("schedule has invalid hours %q: expected from-to", hours)
+		}
+		from, err := parseClock(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("schedule hours %q: %w", hours, err)
+		}
+		to, err := parseClock(bounds[1])
+		if err != nil {
+			return nil, fmt.Errorf("schedule hours %q: %w", hours, err)
+		}
+		if from == to {
+			return nil, fmt.Errorf("schedule hours %q is empty", hours)
+		}
+		a.ranges = append(a.ranges, [2]int{from, to})
+	}
+
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("schedule timezone: %w", err)
+		}
+		a.location = location
+	}
+	return a, nil
+}
+
+// parseClock returns the minutes since midnight of a "15:04" time. "24:00" is
+// accepted as the end of the day.
+func parseClock(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (a *activeHours) active(now time.Time) bool {
+	now = now.In(a.location)
+	minute := now.Hour()*60 + now.Minute()
+	today := now.Weekday()
+	yesterday := (today + 6) % 7
+	for _, r := range a.ranges {
+		from, to := r[0], r[1]
+		if from < to {
+			if a.days[today] && minute >= from && minute < to {
+				return true
+			}
+			continue
+		}
+		// past midnight
+		if (a.days[today] && minute >= from) || (a.days[yesterday] && minute < to) {
+			return true
+		}
+	}
+	return false
+}
+
+// applySchedules pauses destinations that are now outside of their schedule and
+// resumes the ones that are back in it
+func (m *Manager) applySchedules() {
+	now := time.Now()
+	for _, destination := range m.destinationMap {
+		if destination.activeHours == nil {
+			continue
+		}
+		inactive := !destination.activeHours.active(now)
+		if inactive == destination.inactive {
+			continue
+		}
+		wasProbing := destination.isProbing()
+		destination.inactive = inactive
+		m.updateProbing(destination, wasProbing)
+	}
+}
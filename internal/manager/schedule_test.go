@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	a, err := parseSchedule(&Schedule{
+		Days:     []string{"mon", "Friday"},
+		Hours:    []string{"08:00-12:00", "22:00-02:00"},
+		Timezone: "UTC",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	monday := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		at       time.Time
+		expected bool
+	}{
+		{monday.Add(8 * time.Hour), true},
+		{monday.Add(12 * time.Hour), false},
+		{monday.Add(23 * time.Hour), true},
+		{monday.Add(25 * time.Hour), true},              // tuesday 01:00, from monday's range
+		{monday.Add(26 * time.Hour), false},             // tuesday 02:00
+		{monday.Add(24*time.Hour + 9*time.Hour), false}, // tuesday 09:00
+		{monday.AddDate(0, 0, 4).Add(9 * time.Hour), true},
+	} {
+		if got := a.active(tc.at); got != tc.expected {
+			t.Fatalf("active(%s) = %t, expected %t", tc.at, got, tc.expected)
+		}
+	}
+
+	if a, err = parseSchedule(&Schedule{}); err != nil || !a.active(monday) {
+		t.Fatalf("expected empty schedule to always be active: %v", err)
+	}
+
+	for _, s := range []Schedule{{Days: []string{"funday"}}, {Hours: []string{"08:00"}}, {Hours: []string{"8-9"}}} {
+		if _, err = parseSchedule(&s); err == nil {
+			t.Fatalf("expected error parsing %+v", s)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+	"github.com/mitchellh/mapstructure"
+)
+
+// requestIdKey is accepted in any destination payload, to be echoed back in its result
+const requestIdKey = "request_id"
+
+// decodeDestination decodes a destination from a yaml or json object. The same
+// keys, those of Destination, are used by the config, the destination topics and
+// the persisted destinations; unknown ones are an error.
+func decodeDestination(value interface{}) (Destination, error) {
+	var destination Destination
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return destination, fmt.Errorf("destination must be an object")
+	}
+	if _, ok = obj[requestIdKey]; ok {
+		trimmed := make(map[string]interface{}, len(obj))
+		for k, v := range obj {
+			if k != requestIdKey {
+				trimmed[k] = v
+			}
+		}
+		obj = trimmed
+	}
+
+	decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		Result:           &destination,
+	})
+	if err := decoder.Decode(obj); err != nil {
+		var mErr *mapstructure.Error
+		if errors.As(err, &mErr) {
+			return Destination{}, errors.New(strings.Join(mErr.Errors, "; "))
+		}
+		return Destination{}, err
+	}
+	return destination, nil
+}
+
+// decodeDestinationJson decodes the json payload of a destination topic
+func decodeDestinationJson(payload string) (Destination, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(payload), &value); err != nil {
+		return Destination{}, fmt.Errorf("invalid json: %w", err)
+	}
+	return decodeDestination(value)
+}
+
+// takeConfigDestinations removes the destinations from a decoded config file, to
+// decode them one by one. A destination with problems is skipped, rather than
+// failing the whole config; the problems are returned.
+func takeConfigDestinations(raw interface{}) ([]Destination, []string) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	list, ok := obj["destinations"].([]interface{})
+	if !ok {
+		// not a list: left for mapstructure to complain about
+		return nil, nil
+	}
+	delete(obj, "destinations")
+
+	var problems []string
+	destinations := make([]Destination, 0, len(list))
+	for i, value := range list {
+		destination, err := decodeDestination(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("destinations[%d]: %v", i, err))
+			continue
+		}
+		destinations = append(destinations, destination)
+	}
+	return destinations, problems
+}
+
+// jsonSchema describes a type as a json schema, using the keys mapstructure decodes
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Tag.Get("mapstructure")
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			properties[name] = jsonSchema(field.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	}
+	return map[string]interface{}{}
+}
+
+// destinationSchema returns the json schema of a destination payload
+func destinationSchema() string {
+	schema := jsonSchema(reflect.TypeOf(Destination{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "mqtt2ping destination"
+	properties := schema["properties"].(map[string]interface{})
+	properties["interval"].(map[string]interface{})["minimum"] = 0
+	properties[requestIdKey] = map[string]interface{}{"type": "string"}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		logger.Errorf("Unable to encode destination schema: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// publishSchema publishes the json schema of destination payloads, retained, for tooling
+func (m *Manager) publishSchema() {
+	msg := mqtt_agent.Msg{Retained: true}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubSchema(destinationSchema())
+	m.mqttPub <- msg
+}
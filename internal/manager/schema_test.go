@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDestinationJson(t *testing.T) {
+	destination, err := decodeDestinationJson(`{"address":"192.168.1.5","interval":10,"tags":["lan"],"request_id":"r1"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if destination.Addr != "192.168.1.5" || destination.IntervalSeconds != 10 || destination.Tags[0] != "lan" {
+		t.Fatalf("unexpected destination: %+v", destination)
+	}
+
+	for _, payload := range []string{
+		`{"address":"192.168.1.5","intervl":10}`,
+		`{"address":"192.168.1.5","schedule":{"day":["mon"]}}`,
+		`["192.168.1.5"]`,
+		`{"address":`,
+	} {
+		if _, err = decodeDestinationJson(payload); err == nil {
+			t.Fatalf("expected error for %s", payload)
+		}
+	}
+}
+
+// TestDestinationJsonKeys makes sure the keys destinations are published with can
+// be decoded back, so the published config can be used as a payload
+func TestDestinationJsonKeys(t *testing.T) {
+	destination := Destination{
+		Name: "tv", Addr: "192.168.1.6", IntervalSeconds: 5, Type: destinationTypeInternet,
+		Targets: []string{"1.1.1.1"}, DependsOn: []string{"router"}, Tags: []string{"lan"},
+		Maintenance: []MaintenanceWindow{{Cron: "0 3 * * 0", DurationSeconds: 60, Timezone: "UTC"}},
+		Schedule:    &Schedule{Days: []string{"mon"}, Hours: []string{"08:00-18:00"}, Timezone: "UTC"},
+	}
+	data, _ := json.Marshal(destinationSyncJson{Name: destination.Name, destinationJson: destination.toJson()})
+	decoded, err := decodeDestinationJson(string(data))
+	if err != nil || !sameConfig(&decoded, &destination) {
+		t.Fatalf("round trip of %s got %+v, %v", data, decoded, err)
+	}
+}
+
+func TestTakeConfigDestinations(t *testing.T) {
+	raw := map[string]interface{}{
+		"interval": 60,
+		"destinations": []interface{}{
+			map[string]interface{}{"address": "192.168.1.5"},
+			map[string]interface{}{"address": "192.168.1.6", "intervl": 5},
+		},
+	}
+	destinations, skipped := takeConfigDestinations(raw)
+	if len(destinations) != 1 || destinations[0].Addr != "192.168.1.5" {
+		t.Fatalf("unexpected destinations: %+v", destinations)
+	}
+	if len(skipped) != 1 || !strings.HasPrefix(skipped[0], "destinations[1]: ") {
+		t.Fatalf("unexpected skipped: %v", skipped)
+	}
+	if _, ok := raw["destinations"]; ok {
+		t.Fatal("expected destinations to be taken from the config")
+	}
+}
+
+func TestDestinationSchema(t *testing.T) {
+	var schema struct {
+		Type                 string
+		Properties           map[string]map[string]interface{}
+		AdditionalProperties bool
+	}
+	if err := json.Unmarshal([]byte(destinationSchema()), &schema); err != nil {
+		t.Fatalf("unexpected schema: %v", err)
+	}
+	if schema.Type != "object" || schema.AdditionalProperties {
+		t.Fatalf("unexpected schema: %+v", schema)
+	}
+
+	keys := []string{"name", requestIdKey}
+	jsonType := reflect.TypeOf(destinationJson{})
+	for i := 0; i < jsonType.NumField(); i++ {
+		keys = append(keys, strings.Split(jsonType.Field(i).Tag.Get("json"), ",")[0])
+	}
+	for _, key := range keys {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Fatalf("key %s missing from schema: %v", key, schema.Properties)
+		}
+	}
+	if schema.Properties["interval"]["type"] != "integer" || schema.Properties["interval"]["minimum"] != float64(0) ||
+		schema.Properties["schedule"]["type"] != "object" {
+		t.Fatalf("unexpected properties: %v", schema.Properties)
+	}
+}
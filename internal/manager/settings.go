@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+// redacted replaces secrets when settings are shown
+const redacted = "REDACTED"
+
+// Settings are the sections of the config used by the application itself, before
+// the manager starts. Empty values are left for env, flags or defaults to fill in.
+type Settings struct {
+	Mqtt    MqttSettings    `yaml:"mqtt"`
+	Logging LoggingSettings `yaml:"logging"`
+}
+
+type MqttSettings struct {
+	ClientId    string `mapstructure:"client" yaml:"client"`
+	BrokerUrl   string `mapstructure:"broker" yaml:"broker"`
+	User        string `mapstructure:"user" yaml:"user"`
+	Pass        string `mapstructure:"pass" yaml:"pass"`
+	TopicPrefix string `mapstructure:"topic" yaml:"topic"`
+}
+
+type LoggingSettings struct {
+	Dir     string `mapstructure:"dir" yaml:"dir"`
+	Verbose *bool  `mapstructure:"verbose" yaml:"verbose"`
+}
+
+// Redacted returns a copy of the settings without the password, including one in the broker url
+func (s MqttSettings) Redacted() MqttSettings {
+	if s.Pass != "" {
+		s.Pass = redacted
+	}
+	if u, err := url.Parse(s.BrokerUrl); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			s.BrokerUrl = u.String()
+		}
+	}
+	return s
+}
+
+// mergeSettings fills in the settings not set yet with the ones of a config file
+func mergeSettings(s *Settings, d *Destinations) {
+	firstString := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	if d.Mqtt != nil {
+		firstString(&s.Mqtt.ClientId, d.Mqtt.ClientId)
+		firstString(&s.Mqtt.BrokerUrl, d.Mqtt.BrokerUrl)
+		firstString(&s.Mqtt.User, d.Mqtt.User)
+		firstString(&s.Mqtt.Pass, d.Mqtt.Pass)
+		firstString(&s.Mqtt.TopicPrefix, d.Mqtt.TopicPrefix)
+	}
+	if d.Logging != nil {
+		firstString(&s.Logging.Dir, d.Logging.Dir)
+		if s.Logging.Verbose == nil {
+			s.Logging.Verbose = d.Logging.Verbose
+		}
+	}
+}
+
+// ReadSettings returns the mqtt and logging sections of the config. As with the
+// other settings, each is taken from the first config file that has it. Nothing is
+// logged, since it is used to set up logging.
+func ReadSettings(configPath string) (*Settings, error) {
+	filenames, err := configFiles(configPath)
+	if err != nil {
+		return nil, err
+	}
+	settings := &Settings{}
+	for _, filename := range filenames {
+		d, err := decodeConfigFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		mergeSettings(settings, d)
+	}
+	return settings, nil
+}
+
+// settingsJson holds the global settings that can be changed at runtime, using
+// the same names as the config yaml. Settings left out are not changed.
+type settingsJson struct {
+	Interval       *int `json:"interval,omitempty"`
+	Advertisements *int `json:"advertisements,omitempty"`
+	UpdateInterval *int `json:"update-interval,omitempty"`
+}
+
+func parseSettings(payload string) (settingsJson, error) {
+	var s settingsJson
+	if err := json.Unmarshal([]byte(payload), &s); err != nil {
+		return s, fmt.Errorf("invalid json: %w", err)
+	}
+	if s.Interval != nil && *s.Interval <= 0 {
+		return s, fmt.Errorf("invalid interval %d", *s.Interval)
+	}
+	if s.Advertisements != nil && *s.Advertisements < 0 {
+		return s, fmt.Errorf("invalid advertisements %d", *s.Advertisements)
+	}
+	if s.UpdateInterval != nil && *s.UpdateInterval < minUpdateStatusIntervalSeconds {
+		return s, fmt.Errorf("update-interval %d is less than %d", *s.UpdateInterval, minUpdateStatusIntervalSeconds)
+	}
+	return s, nil
+}
+
+// advertiseInterval is the period of the advertisements ticker. Without
+// advertisements, it just never fires.
+func (m *Manager) advertiseInterval() time.Duration {
+	if m.advertisementsSeconds > 0 {
+		return time.Duration(m.advertisementsSeconds) * time.Second
+	}
+	return time.Duration(1<<63 - 1) // approximately 290 years
+}
+
+func (m *Manager) updateStatusInterval() time.Duration {
+	return time.Duration(max(minUpdateStatusIntervalSeconds, m.updateStatusIntervalSeconds)) * time.Second
+}
+
+func (m *Manager) logTickers() {
+	if m.advertisementsSeconds > 0 {
+		logger.Infof("Advertisements will be sent every: %v seconds", m.advertisementsSeconds)
+	}
+	logger.Infof("Checking for pinger updates every: %v", m.updateStatusInterval())
+}
+
+// resetTickers applies the current settings to the tickers of the main loop, if
+// it is running
+func (m *Manager) resetTickers() {
+	if m.advertiseTick == nil {
+		return
+	}
+	m.advertiseTick.Reset(m.advertiseInterval())
+	m.updateStatusTick.Reset(m.updateStatusInterval())
+	m.logTickers()
+}
+
+func (m *Manager) effectiveSettings() settingsJson {
+	interval, advertisements, updateInterval := m.defaultIntervalSeconds, m.advertisementsSeconds, m.updateStatusIntervalSeconds
+	return settingsJson{Interval: &interval, Advertisements: &advertisements, UpdateInterval: &updateInterval}
+}
+
+// publishSettings publishes the effective settings, retained, so they can be
+// read at any time
+func (m *Manager) publishSettings() {
+	payload, err := json.Marshal(m.effectiveSettings())
+	if err != nil {
+		logger.Errorf("Unable to encode settings: %v", err)
+		return
+	}
+	msg := mqtt_agent.Msg{Retained: true}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubSettingsEffective(string(payload))
+	m.mqttPub <- msg
+}
+
+func (m *Manager) msgParseSettings(payload string) {
+	if payload == "" {
+		// likely the removal of a retained message
+		return
+	}
+	s, err := parseSettings(payload)
+	if err != nil {
+		logger.Warnf("Ignoring settings: %v", err)
+		m.publishResult("settings", "settings", payload, err)
+		return
+	}
+	if s.Interval != nil {
+		m.defaultIntervalSeconds = *s.Interval
+		m.applyDefaultInterval()
+	}
+	if s.Advertisements != nil {
+		m.advertisementsSeconds = *s.Advertisements
+	}
+	if s.UpdateInterval != nil {
+		m.updateStatusIntervalSeconds = *s.UpdateInterval
+	}
+	m.resetTickers()
+	logger.Infof("Changed settings: %s", payload)
+	m.publishSettings()
+	m.publishResult("settings", "settings", payload, nil)
+}
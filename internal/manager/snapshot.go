@@ -0,0 +1,296 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+// snapshotJson is an export of the destinations, to import on another instance.
+// The destinations have the format of the persisted destinations and the state,
+// when included, the format of the state file.
+type snapshotJson struct {
+	RequestId    string                          `json:"request_id,omitempty"`
+	Destinations []destinationSyncJson           `json:"destinations"`
+	State        map[string]destinationStateJson `json:"state,omitempty"`
+}
+
+// exportJson is the optional payload of the export topic
+type exportJson struct {
+	State     bool   `json:"state"`
+	RequestId string `json:"request_id"`
+}
+
+func newSnapshot(destinations []*Destination, states map[string]destinationStateJson) *snapshotJson {
+	sort.Slice(destinations, func(i, j int) bool { return destinations[i].Name < destinations[j].Name })
+	snapshot := &snapshotJson{Destinations: []destinationSyncJson{}}
+	for _, destination := range destinations {
+		snapshot.Destinations = append(snapshot.Destinations,
+			destinationSyncJson{Name: destination.Name, destinationJson: destination.toJson()})
+		if saved, ok := states[destination.Name]; ok {
+			if snapshot.State == nil {
+				snapshot.State = make(map[string]destinationStateJson)
+			}
+			snapshot.State[destination.Name] = saved
+		}
+	}
+	return snapshot
+}
+
+// decodeSnapshot returns the destinations of a snapshot and their state, if included
+func decodeSnapshot(data []byte, asYaml bool) ([]Destination, map[string]destinationStateJson, error) {
+	var doc map[string]interface{}
+	if err := decodeDocument(data, asYaml, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	for key := range doc {
+		switch key {
+		case "destinations", "state", requestIdKey:
+		default:
+			return nil, nil, fmt.Errorf("invalid snapshot: unknown key %q", key)
+		}
+	}
+	entries, ok := doc["destinations"].([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid snapshot: no list of destinations")
+	}
+	destinations, err := decodeDestinationList(entries)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+
+	states := make(map[string]destinationStateJson)
+	if doc["state"] != nil {
+		// go through json, so yaml uses the same keys
+		stateData, err := json.Marshal(doc["state"])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot state: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(stateData))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&states); err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot state: %w", err)
+		}
+	}
+	return destinations, states, nil
+}
+
+// snapshot returns all destinations, optionally with their current state
+func (m *Manager) snapshot(withState bool) *snapshotJson {
+	destinations := make([]*Destination, 0, len(m.destinationMap))
+	for _, destination := range m.destinationMap {
+		destinations = append(destinations, destination)
+	}
+	var states map[string]destinationStateJson
+	if withState {
+		states = m.destinationStates(time.Now())
+	}
+	return newSnapshot(destinations, states)
+}
+
+// importSnapshot adds the destinations of a snapshot, or updates the ones with the
+// same name; the others are left alone. The imported destinations are handled as
+// added via mqtt. States are applied to the destinations they are included for.
+func (m *Manager) importSnapshot(destinations []Destination, states map[string]destinationStateJson) *syncSummary {
+	if m.savedStates == nil {
+		m.savedStates = make(map[string]destinationStateJson)
+	}
+	for name, saved := range states {
+		m.savedStates[name] = saved
+	}
+
+	// added destinations restore their state as they get added; the others now
+	summary := m.syncDestinations(destinations, func(*Destination) bool { return false })
+	for name := range states {
+		if _, pending := m.savedStates[name]; !pending {
+			continue
+		}
+		if destination, ok := m.destinationMap[name]; ok {
+			m.restoreState(destination)
+			m.publishDestination(destination)
+		}
+		delete(m.savedStates, name)
+	}
+	return summary
+}
+
+func (m *Manager) msgParseExport(payload string) {
+	var req exportJson
+	if payload != "" {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(payload)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			logger.Warnf("Ignoring export: invalid json: %v", err)
+			m.publishResult("export", "export", payload, fmt.Errorf("invalid json: %w", err))
+			return
+		}
+	}
+
+	snapshot := m.snapshot(req.State)
+	snapshot.RequestId = req.RequestId
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		logger.Errorf("Unable to encode snapshot: %v", err)
+		return
+	}
+	logger.Infof("Exporting %d destinations", len(snapshot.Destinations))
+	msg := mqtt_agent.Msg{}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubSnapshot(string(data))
+	m.mqttPub <- msg
+	m.publishResult("export", "export", payload, nil)
+}
+
+func (m *Manager) msgParseImport(payload string) {
+	if payload == "" {
+		// likely the removal of a retained message
+		return
+	}
+	destinations, states, err := decodeSnapshot([]byte(payload), false)
+	if err != nil {
+		logger.Warnf("Ignoring import: %v", err)
+		summary := &syncSummary{Added: []string{}, Updated: []string{}, Removed: []string{}}
+		summary.addError("", "%v", err)
+		m.publishSyncSummary(summary)
+		return
+	}
+	summary := m.importSnapshot(destinations, states)
+	logger.Infof("Imported destinations: %s", summary)
+	m.publishSyncSummary(summary)
+}
+
+// readPersisted reads the persisted destinations. A missing file has none.
+func readPersisted(filename string) ([]Destination, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open persisted destinations %s: %w", filename, err)
+	}
+	destinations, err := decodeDestinations(data, IsYamlFile(filename))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse persisted destinations %s: %w", filename, err)
+	}
+	return destinations, nil
+}
+
+// ExportSnapshot returns the destinations of the config and the persisted
+// destinations, and optionally their saved state, as a snapshot to import on
+// another instance. Destinations read from sources are not included, since
+// they only exist while running.
+func ExportSnapshot(config *Config, withState, asYaml bool) ([]byte, error) {
+	d, err := readConfig(config.Filename)
+	if err != nil {
+		return nil, err
+	}
+	all := d.Destinations
+	if config.PersistFilename != "" {
+		persisted, err := readPersisted(config.PersistFilename)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, persisted...)
+	}
+
+	// the first one with a name wins, like at startup
+	names := make(map[string]bool, len(all))
+	destinations := make([]*Destination, 0, len(all))
+	for i := range all {
+		all[i].Name = destinationName(&all[i])
+		if all[i].Name == "" || names[all[i].Name] {
+			continue
+		}
+		names[all[i].Name] = true
+		destinations = append(destinations, &all[i])
+	}
+
+	var states map[string]destinationStateJson
+	if withState && config.StateFilename != "" {
+		states, err = readStateFile(config.StateFilename)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return encodeDocument(newSnapshot(destinations, states), asYaml)
+}
+
+// ImportSnapshot adds the destinations of a snapshot to the persisted
+// destinations, replacing the ones with the same name, and their state, if
+// included, to the state file. They are loaded on the next start. It fails if
+// an instance is running with the same persisted destinations, since it would
+// overwrite them; the import topic is for running instances. It returns how
+// many destinations were imported and how many states were skipped, for lack
+// of a state file.
+func ImportSnapshot(config *Config, data []byte, asYaml bool) (imported, skippedStates int, err error) {
+	if config.PersistFilename == "" {
+		return 0, 0, fmt.Errorf("no file to persist destinations to")
+	}
+	destinations, states, err := decodeSnapshot(data, asYaml)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	unlock, err := lockPersisted(config.PersistFilename)
+	if errors.Is(err, errLocked) {
+		return 0, 0, fmt.Errorf("%w; import via the mqtt import topic instead", err)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	persisted, err := readPersisted(config.PersistFilename)
+	if err != nil {
+		return 0, 0, err
+	}
+	byName := make(map[string]*Destination)
+	for i := range persisted {
+		persisted[i].Name = destinationName(&persisted[i])
+		byName[persisted[i].Name] = &persisted[i]
+	}
+	for i := range destinations {
+		destinations[i].Name = destinationName(&destinations[i])
+		byName[destinations[i].Name] = &destinations[i]
+	}
+
+	all := make([]*Destination, 0, len(byName))
+	for _, destination := range byName {
+		all = append(all, destination)
+	}
+	persistData, err := encodeDestinations(newSnapshot(all, nil).Destinations, IsYamlFile(config.PersistFilename))
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to encode persisted destinations: %w", err)
+	}
+	if err = writeFileAtomic(config.PersistFilename, persistData); err != nil {
+		return 0, 0, fmt.Errorf("unable to save persisted destinations %s: %w", config.PersistFilename, err)
+	}
+
+	if len(states) == 0 {
+		return len(destinations), 0, nil
+	}
+	if config.StateFilename == "" {
+		return len(destinations), len(states), nil
+	}
+	saved, err := readStateFile(config.StateFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		saved, err = make(map[string]destinationStateJson), nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	for name, state := range states {
+		saved[name] = state
+	}
+	if err = writeStateFile(config.StateFilename, saved); err != nil {
+		return 0, 0, fmt.Errorf("unable to save state %s: %w", config.StateFilename, err)
+	}
+	return len(destinations), 0, nil
+}
@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportAndImportSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml":       "destinations:\n  - address: 192.168.1.1\n    name: router\n    tags: [\"lan\"]\n",
+		"destinations.json": `[{"name":"nas","address":"192.168.1.5","interval":10},{"name":"router","address":"10.0.0.1"}]`,
+		"state.json":        `{"nas":{"state":"online","is_online":true,"packets_sent":5,"packets_received":4}}`,
+	})
+	config := &Config{
+		Filename:        filepath.Join(dir, "config.yaml"),
+		PersistFilename: filepath.Join(dir, "destinations.json"),
+		StateFilename:   filepath.Join(dir, "state.json"),
+	}
+	data, err := ExportSnapshot(config, true, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	target := &Config{
+		PersistFilename: filepath.Join(dir, "imported.yaml"),
+		StateFilename:   filepath.Join(dir, "imported-state.json"),
+	}
+	count, skippedStates, err := ImportSnapshot(target, data, true)
+	if err != nil || count != 2 || skippedStates != 0 {
+		t.Fatalf("unexpected import of %d, %v:\n%s", count, err, data)
+	}
+	destinations, err := readPersisted(target.PersistFilename)
+	if err != nil || len(destinations) != 2 {
+		t.Fatalf("unexpected persisted destinations %+v, %v", destinations, err)
+	}
+	// the router of the config wins over the persisted one
+	if destinations[1].Name != "router" || destinations[1].Addr != "192.168.1.1" || destinations[1].Tags[0] != "lan" {
+		t.Fatalf("unexpected router: %+v", destinations[1])
+	}
+	states, err := readStateFile(target.StateFilename)
+	if err != nil || states["nas"].PacketsReceived != 4 || len(states) != 1 {
+		t.Fatalf("unexpected states %+v, %v", states, err)
+	}
+
+	if _, _, err = ImportSnapshot(target, []byte(`{"destinations":[],"extra":1}`), false); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+
+	// without a state file, the states are reported as skipped
+	target.StateFilename = ""
+	if _, skippedStates, err = ImportSnapshot(target, data, true); err != nil || skippedStates != 1 {
+		t.Fatalf("expected 1 skipped state, got %d, %v", skippedStates, err)
+	}
+
+	// a running instance owns its persisted destinations
+	unlock, err := lockPersisted(target.PersistFilename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer unlock()
+	if _, _, err = ImportSnapshot(target, data, true); !errors.Is(err, errLocked) {
+		t.Fatalf("expected import to be refused while in use, got %v", err)
+	}
+}
+
+func TestMsgParseExportAndImport(t *testing.T) {
+	m, pub := newTestManager()
+	defer func() {
+		for _, destination := range m.destinationMap {
+			destination.stopProbe()
+		}
+	}()
+	m.destinationMap["tv"] = &Destination{Name: "tv", Addr: "192.168.1.6", inactive: true, state: "inactive", packetsSent: 7}
+
+	m.msgParseExport(`{"state":true,"request_id":"r1"}`)
+	msg := <-pub
+	var snapshot snapshotJson
+	if err := json.Unmarshal([]byte(msg.Payload), &snapshot); err != nil {
+		t.Fatalf("unexpected snapshot %s: %v", msg.Payload, err)
+	}
+	if msg.Topic != "snapshot" || snapshot.RequestId != "r1" || len(snapshot.Destinations) != 1 ||
+		snapshot.State["tv"].PacketsSent != 7 {
+		t.Fatalf("unexpected snapshot: %s", msg.Payload)
+	}
+	if msg = <-pub; msg.Payload != `{"name":"export","action":"export","request_id":"r1","code":"ok"}` {
+		t.Fatalf("unexpected export result: %+v", msg)
+	}
+	m.msgParseExport(`{"state":"yes please","request_id":"r2"}`)
+	if msg = <-pub; msg.Topic != "result/export" || !strings.Contains(msg.Payload, `"request_id":"r2","code":"invalid"`) || len(pub) != 0 {
+		t.Fatalf("unexpected export result: %+v", msg)
+	}
+
+	m.msgParseImport(`{"destinations":[{"name":"nas","address":"127.0.0.1"},{"name":"tv","address":"192.168.1.6"}],` +
+		`"state":{"nas":{"packets_sent":3},"tv":{"packets_sent":9}}}`)
+	if m.destinationMap["nas"] == nil || m.destinationMap["nas"].packetsSent != 3 || m.destinationMap["nas"].source != sourceMqtt {
+		t.Fatalf("unexpected imported destination: %+v", m.destinationMap["nas"])
+	}
+	if m.destinationMap["tv"].packetsSent != 9 || len(m.savedStates) != 0 {
+		t.Fatalf("expected state of existing destination to be restored: %+v", m.destinationMap["tv"])
+	}
+	var summary syncSummary
+	for len(pub) > 0 {
+		msg = <-pub
+	}
+	if err := json.Unmarshal([]byte(msg.Payload), &summary); err != nil || len(summary.Added) != 1 || summary.Unchanged != 1 {
+		t.Fatalf("unexpected summary %s: %v", msg.Payload, err)
+	}
+}
@@ -0,0 +1,260 @@
+package manager
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antigloss/go/logger"
+)
+
+const (
+	sourceTypeDnsmasq = "dnsmasq"
+	sourceTypeDhcpd   = "dhcpd"
+	sourceTypeHosts   = "hosts"
+
+	defaultSourceRefreshSeconds = 60
+
+	// sourcesCheckSeconds is how often we look for sources that are due for a refresh
+	sourcesCheckSeconds = 5
+)
+
+// Source is a file that provides destinations in bulk, such as a DHCP leases file.
+// Destinations created from a source are owned by it and are removed when they no
+// longer show up in the file.
+type Source struct {
+	Type            string `mapstructure:"type"`
+	Path            string `mapstructure:"path"`
+	RefreshSeconds  int    `mapstructure:"refresh"`
+	IntervalSeconds int    `mapstructure:"interval"`
+	Prefix          string `mapstructure:"prefix"`
+	lastRefresh     time.Time
+}
+
+// sourceEntry is a hostname to address mapping read from a source file.
+type sourceEntry struct {
+	Name string
+	Addr string
+}
+
+func (s *Source) id() string {
+	return "file:" + s.Path
+}
+
+func (s *Source) read() ([]sourceEntry, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch s.Type {
+	case sourceTypeDnsmasq:
+		return parseDnsmasqLeases(f, time.Now())
+	case sourceTypeDhcpd:
+		return parseDhcpdLeases(f, time.Now())
+	case sourceTypeHosts:
+		return parseHosts(f)
+	}
+	return nil, fmt.Errorf("unknown source type %q", s.Type)
+}
+
+// parseDnsmasqLeases reads lines in the format: <expiry> <mac> <ip> <hostname> <client-id>
+// Entries without a hostname ("*") or with an expired lease are skipped.
+func parseDnsmasqLeases(r io.Reader, now time.Time) ([]sourceEntry, error) {
+	var entries []sourceEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if expiry != 0 && time.Unix(expiry, 0).Before(now) {
+			continue
+		}
+		if fields[3] == "*" || net.ParseIP(fields[2]) == nil {
+			continue
+		}
+		entries = append(entries, sourceEntry{Name: fields[3], Addr: fields[2]})
+	}
+	return dedupSourceEntries(entries), scanner.Err()
+}
+
+// parseDhcpdLeases reads the lease blocks of an ISC dhcpd.leases file. Since dhcpd
+// appends to this file, later blocks for the same address replace earlier ones.
+func parseDhcpdLeases(r io.Reader, now time.Time) ([]sourceEntry, error) {
+	type lease struct {
+		addr     string
+		hostname string
+		active   bool
+		ends     time.Time
+	}
+	var order []string
+	leases := make(map[string]*lease)
+	var current *lease
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimSuffix(line, ";"))
+		switch {
+		case current == nil && len(fields) >= 3 && fields[0] == "lease" && fields[2] == "{":
+			current = &lease{addr: fields[1], active: true}
+		case current == nil:
+			continue
+		case fields[0] == "}":
+			if _, ok := leases[current.addr]; !ok {
+				order = append(order, current.addr)
+			}
+			leases[current.addr] = current
+			current = nil
+		case fields[0] == "client-hostname" && len(fields) >= 2:
+			current.hostname = strings.Trim(strings.Join(fields[1:], " "), "\"")
+		case fields[0] == "binding" && len(fields) >= 3 && fields[1] == "state":
+			current.active = fields[2] == "active"
+		case fields[0] == "ends" && len(fields) >= 4:
+			// ends <weekday> <yyyy/mm/dd> <hh:mm:ss>; all times are UTC
+			if t, err := time.Parse("2006/01/02 15:04:05", fields[2]+" "+fields[3]); err == nil {
+				current.ends = t
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries []sourceEntry
+	for _, addr := range order {
+		l := leases[addr]
+		if !l.active || l.hostname == "" || net.ParseIP(l.addr) == nil {
+			continue
+		}
+		if !l.ends.IsZero() && l.ends.Before(now) {
+			continue
+		}
+		entries = append(entries, sourceEntry{Name: l.hostname, Addr: l.addr})
+	}
+	return dedupSourceEntries(entries), nil
+}
+
+// parseHosts reads a file in the /etc/hosts format: <ip> <hostname> [aliases...]
+// Only the canonical hostname is used.
+func parseHosts(r io.Reader) ([]sourceEntry, error) {
+	var entries []sourceEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		entries = append(entries, sourceEntry{Name: fields[1], Addr: fields[0]})
+	}
+	return dedupSourceEntries(entries), scanner.Err()
+}
+
+// dedupSourceEntries keeps the first entry for a given name, which also makes sure
+// we do not end up with names that cannot be used in mqtt topics.
+func dedupSourceEntries(entries []sourceEntry) []sourceEntry {
+	seen := make(map[string]bool, len(entries))
+	result := entries[:0]
+	for _, entry := range entries {
+		if seen[entry.Name] || strings.ContainsAny(entry.Name, "/+#") {
+			continue
+		}
+		seen[entry.Name] = true
+		result = append(result, entry)
+	}
+	return result
+}
+
+func validateSource(source *Source) error {
+	switch source.Type {
+	case sourceTypeDnsmasq, sourceTypeDhcpd, sourceTypeHosts:
+	default:
+		return fmt.Errorf("invalid source type %q for %s", source.Type, source.Path)
+	}
+	if source.Path == "" {
+		return fmt.Errorf("source of type %s has no path", source.Type)
+	}
+	return nil
+}
+
+func (m *Manager) addSource(source Source) error {
+	if err := validateSource(&source); err != nil {
+		return err
+	}
+	if source.RefreshSeconds <= 0 {
+		source.RefreshSeconds = defaultSourceRefreshSeconds
+	}
+	m.sources = append(m.sources, &source)
+	logger.Infof("Added %s source %s (refresh every %d seconds)", source.Type, source.Path, source.RefreshSeconds)
+	return nil
+}
+
+// refreshSources re-reads the sources that are due, unless force is set, in which
+// case all of them are read.
+func (m *Manager) refreshSources(force bool) {
+	now := time.Now()
+	for _, source := range m.sources {
+		if !force && now.Sub(source.lastRefresh) < time.Duration(source.RefreshSeconds)*time.Second {
+			continue
+		}
+		source.lastRefresh = now
+		m.refreshSource(source)
+	}
+}
+
+func (m *Manager) refreshSource(source *Source) {
+	entries, err := source.read()
+	if err != nil {
+		// keep what we have; a missing or half written file should not remove destinations
+		logger.Warnf("Unable to read %s source %s: %v", source.Type, source.Path, err)
+		return
+	}
+
+	wanted := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		wanted[source.Prefix+entry.Name] = entry.Addr
+	}
+
+	for name, destination := range m.destinationMap {
+		if destination.source != source.id() {
+			continue
+		}
+		if addr, ok := wanted[name]; !ok || addr != destination.Addr {
+			m.handleDestinationMsgDel(name, false)
+		}
+	}
+
+	for _, entry := range entries {
+		name := source.Prefix + entry.Name
+		if destination, ok := m.destinationMap[name]; ok {
+			if destination.source != source.id() {
+				logger.Tracef("Skipping %s from %s: name already used", name, source.Path)
+			}
+			continue
+		}
+		m.addDestination(Destination{
+			Name:            name,
+			Addr:            entry.Addr,
+			IntervalSeconds: source.IntervalSeconds,
+			source:          source.id(),
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDnsmasqLeases(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	leases := `1700000100 aa:bb:cc:dd:ee:01 192.168.1.10 printer 01:aa:bb:cc:dd:ee:01
+1600000000 aa:bb:cc:dd:ee:02 192.168.1.11 expired *
+0 aa:bb:cc:dd:ee:03 192.168.1.12 nas *
+1700000100 aa:bb:cc:dd:ee:04 192.168.1.13 * *
+1700000100 aa:bb:cc:dd:ee:05 192.168.1.14 printer *
+`
+	entries, err := parseDnsmasqLeases(strings.NewReader(leases), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []sourceEntry{{"printer", "192.168.1.10"}, {"nas", "192.168.1.12"}}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Fatalf("entry %d: expected %v, got %v", i, expected[i], entries[i])
+		}
+	}
+}
+
+func TestParseDhcpdLeases(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	leases := `# The format of this file is documented in the dhcpd.leases(5) manual page.
+lease 192.168.1.20 {
+  starts 1 2024/01/01 00:00:00;
+  ends 3 2024/01/03 00:00:00;
+  binding state active;
+  client-hostname "laptop";
+}
+lease 192.168.1.21 {
+  ends 3 2024/01/03 00:00:00;
+  binding state free;
+  client-hostname "gone";
+}
+lease 192.168.1.22 {
+  ends 1 2024/01/01 00:00:00;
+  binding state active;
+  client-hostname "stale";
+}
+lease 192.168.1.20 {
+  ends 4 2024/01/04 00:00:00;
+  binding state active;
+  client-hostname "laptop2";
+}
+`
+	entries, err := parseDhcpdLeases(strings.NewReader(leases), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0] != (sourceEntry{"laptop2", "192.168.1.20"}) {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	hosts := `# comment
+127.0.0.1 localhost
+::1 localhost ip6-localhost
+192.168.1.30   tv tv.lan  # living room
+not-an-ip foo
+192.168.1.31 bad/name
+`
+	entries, err := parseHosts(strings.NewReader(hosts))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []sourceEntry{{"localhost", "127.0.0.1"}, {"tv", "192.168.1.30"}}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Fatalf("entry %d: expected %v, got %v", i, expected[i], entries[i])
+		}
+	}
+}
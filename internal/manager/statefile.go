@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/antigloss/go/logger"
+)
+
+// stateSaveSeconds is how often the state file is written, besides on shutdown
+const stateSaveSeconds = 60
+
+// stateExpiry is how long the saved state of a destination that is not added
+// again is kept in the state file, e.g. while its source can not be read
+const stateExpiry = 24 * time.Hour
+
+// destinationStateJson is what the state file keeps for each destination, so it
+// does not start over as undetermined after a restart
+type destinationStateJson struct {
+	State              string        `json:"state,omitempty"`
+	StateSince         time.Time     `json:"state_since"`
+	IsOnline           bool          `json:"is_online"`
+	DownSince          time.Time     `json:"down_since"`
+	PacketsSent        int           `json:"packets_sent"`
+	PacketsReceived    int           `json:"packets_received"`
+	ConsecutiveOffline int           `json:"consecutive_offline"`
+	Stats              []statsSample `json:"stats,omitempty"`
+	SavedAt            time.Time     `json:"saved_at"`
+}
+
+// writeFileAtomic replaces the file, so readers never see it partially written
+func writeFileAtomic(filename string, data []byte) error {
+	tmpFilename := filename + ".tmp"
+	if err := os.WriteFile(tmpFilename, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+// readStateFile reads the states of destinations, by name, from a state file
+func readStateFile(filename string) (map[string]destinationStateJson, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open state %s: %w", filename, err)
+	}
+	states := make(map[string]destinationStateJson)
+	if err = json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("unable to parse state %s: %w", filename, err)
+	}
+	return states, nil
+}
+
+func writeStateFile(filename string, states map[string]destinationStateJson) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode state: %w", err)
+	}
+	return writeFileAtomic(filename, data)
+}
+
+// loadState reads the state file written by a previous run. The states are
+// restored as the destinations get added. A missing file is not an error.
+func (m *Manager) loadState() error {
+	if m.stateFilename == "" {
+		return nil
+	}
+	states, err := readStateFile(m.stateFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Infof("No saved state in %s yet", m.stateFilename)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for name, saved := range states {
+		if saved.SavedAt.IsZero() {
+			// written by an older version; expires from now
+			saved.SavedAt = now
+			states[name] = saved
+		}
+	}
+	m.savedStates = states
+	logger.Infof("Loaded state of %d destinations from %s", len(states), m.stateFilename)
+	return nil
+}
+
+// restoreState applies the saved state of the destination, if there is one.
+// Each saved state is used only once, by the first destination with its name.
+// States about not being pinged, like paused, are derived from the config and
+// commands instead, as when restoring from retained messages.
+func (m *Manager) restoreState(destination *Destination) {
+	saved, ok := m.savedStates[destination.Name]
+	if !ok {
+		return
+	}
+	delete(m.savedStates, destination.Name)
+	if restorableState(saved.State) {
+		destination.state = saved.State
+		destination.stateSince = saved.StateSince
+	}
+	destination.lastIsOnline = saved.IsOnline
+	destination.downSince = saved.DownSince
+	destination.packetsSent = saved.PacketsSent
+	destination.packetsRecv = saved.PacketsReceived
+	destination.consecutiveOfflines = saved.ConsecutiveOffline
+	destination.statsSamples = saved.Stats
+	logger.Infof("Restored state of destination %s: %s", destination.Name, destination.currentState())
+}
+
+func (d *Destination) savedState(now time.Time) destinationStateJson {
+	return destinationStateJson{
+		State:              d.state,
+		StateSince:         d.stateSince,
+		IsOnline:           d.lastIsOnline,
+		DownSince:          d.downSince,
+		PacketsSent:        d.packetsSent,
+		PacketsReceived:    d.packetsRecv,
+		ConsecutiveOffline: d.consecutiveOfflines,
+		Stats:              d.statsSamples,
+		SavedAt:            now,
+	}
+}
+
+// destinationStates returns the state of the destinations, and the saved states
+// not restored yet, until they expire, so they are not lost if their destination
+// is added later
+func (m *Manager) destinationStates(now time.Time) map[string]destinationStateJson {
+	states := make(map[string]destinationStateJson, len(m.destinationMap)+len(m.savedStates))
+	for name, saved := range m.savedStates {
+		if now.Sub(saved.SavedAt) > stateExpiry {
+			logger.Infof("Dropping saved state of destination %s, not added since %s",
+				name, saved.SavedAt.Format(time.RFC3339))
+			delete(m.savedStates, name)
+			continue
+		}
+		states[name] = saved
+	}
+	for name, destination := range m.destinationMap {
+		states[name] = destination.savedState(now)
+	}
+	return states
+}
+
+func (m *Manager) saveState() {
+	if m.stateFilename == "" {
+		return
+	}
+	states := m.destinationStates(time.Now())
+	if err := writeStateFile(m.stateFilename, states); err != nil {
+		logger.Errorf("Unable to save state %s: %v", m.stateFilename, err)
+		return
+	}
+	logger.Tracef("Saved state of %d destinations to %s", len(states), m.stateFilename)
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveAndRestoreState(t *testing.T) {
+	downSince := time.Date(2030, 1, 1, 8, 0, 0, 0, time.UTC)
+	samples := []statsSample{{At: downSince, PacketsSent: 4, PacketsReceived: 4},
+		{At: downSince.Add(time.Minute), PacketsSent: 10, PacketsReceived: 7}}
+	m, _ := newTestManager()
+	m.stateFilename = filepath.Join(t.TempDir(), "state.json")
+	m.destinationMap["nas"] = &Destination{Name: "nas", state: "offline", stateSince: downSince, downSince: downSince,
+		packetsSent: 10, packetsRecv: 7, consecutiveOfflines: 4, statsSamples: samples}
+	m.destinationMap["tv"] = &Destination{Name: "tv", state: "online", lastIsOnline: true, packetsSent: 3, packetsRecv: 3}
+	m.saveState()
+
+	restarted, _ := newTestManager()
+	restarted.stateFilename = m.stateFilename
+	if err := restarted.loadState(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nas := &Destination{Name: "nas"}
+	restarted.restoreState(nas)
+	if nas.state != "offline" || !nas.stateSince.Equal(downSince) || !nas.downSince.Equal(downSince) ||
+		nas.packetsSent != 10 || nas.packetsRecv != 7 || nas.consecutiveOfflines != 4 {
+		t.Fatalf("unexpected restored destination: %+v", nas)
+	}
+	if sent, received := nas.windowStats(); sent != 6 || received != 3 {
+		t.Fatalf("unexpected restored window stats: sent %d received %d", sent, received)
+	}
+	if len(restarted.savedStates) != 1 {
+		t.Fatalf("expected the restored state to be used once, left %v", restarted.savedStates)
+	}
+
+	// not being pinged is not restored, it depends on the config and commands
+	restarted.savedStates["tv"] = destinationStateJson{State: "paused", PacketsSent: 3}
+	tv := &Destination{Name: "tv"}
+	restarted.restoreState(tv)
+	if tv.state != "" || !tv.stateSince.IsZero() || tv.packetsSent != 3 {
+		t.Fatalf("unexpected restored paused destination: %+v", tv)
+	}
+
+	other := &Destination{Name: "printer"}
+	restarted.restoreState(other)
+	if other.state != "" || other.packetsSent != 0 {
+		t.Fatalf("unexpected state for unknown destination: %+v", other)
+	}
+}
+
+func TestLoadStateMissingFile(t *testing.T) {
+	m, _ := newTestManager()
+	m.stateFilename = filepath.Join(t.TempDir(), "missing.json")
+	if err := m.loadState(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSaveStateKeepsUnrestoredStates(t *testing.T) {
+	now := time.Now()
+	m, _ := newTestManager()
+	m.stateFilename = filepath.Join(t.TempDir(), "state.json")
+	m.savedStates = map[string]destinationStateJson{
+		"printer": {State: "offline", PacketsSent: 5, SavedAt: now.Add(-time.Hour)},
+		"old":     {State: "online", SavedAt: now.Add(-stateExpiry - time.Minute)},
+	}
+	m.destinationMap["tv"] = &Destination{Name: "tv", state: "online", lastIsOnline: true}
+	m.saveState()
+
+	states, err := readStateFile(m.stateFilename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("expected tv and printer to be saved, got %v", states)
+	}
+	if printer := states["printer"]; printer.PacketsSent != 5 || !printer.SavedAt.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("unexpected carried state of printer: %+v", printer)
+	}
+	if tv := states["tv"]; tv.SavedAt.IsZero() {
+		t.Fatalf("expected the save time of tv: %+v", tv)
+	}
+	if _, ok := m.savedStates["old"]; ok {
+		t.Fatalf("expected the expired state to be dropped")
+	}
+}
@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+// destinationSyncJson is an element of the array published on the destinations topic
+type destinationSyncJson struct {
+	Name string
+	destinationJson
+}
+
+// syncSummary tells what changed after applying a desired set of destinations
+type syncSummary struct {
+	Added     []string          `json:"added"`
+	Updated   []string          `json:"updated"`
+	Removed   []string          `json:"removed"`
+	Unchanged int               `json:"unchanged"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+func (s *syncSummary) addError(name, format string, args ...interface{}) {
+	if s.Errors == nil {
+		s.Errors = make(map[string]string)
+	}
+	s.Errors[name] = fmt.Sprintf(format, args...)
+}
+
+func (s *syncSummary) String() string {
+	return fmt.Sprintf("added %d updated %d removed %d unchanged %d errors %d",
+		len(s.Added), len(s.Updated), len(s.Removed), s.Unchanged, len(s.Errors))
+}
+
+// sameConfig compares the exported, i.e. configurable, fields of two destinations
+func sameConfig(a, b *Destination) bool {
+	va, vb := reflect.ValueOf(*a), reflect.ValueOf(*b)
+	for i := 0; i < va.NumField(); i++ {
+		if !va.Type().Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// destinationName is the name a destination gets when added without one
+func destinationName(destination *Destination) string {
+	if destination.Name != "" {
+		return destination.Name
+	}
+	switch destination.Type {
+	case destinationTypeGateway, destinationTypeInternet:
+		return destination.Type
+	}
+	return destination.Addr
+}
+
+// syncDestinations makes the destinations for which owned returns true match the
+// desired ones: missing ones are added, changed ones are updated and the ones not
+// desired are removed. Destinations not owned are left alone, unless desired.
+func (m *Manager) syncDestinations(desired []Destination, owned func(*Destination) bool) *syncSummary {
+	summary := &syncSummary{Added: []string{}, Updated: []string{}, Removed: []string{}}
+
+	wanted := make(map[string]bool, len(desired))
+	for i := range desired {
+		name := destinationName(&desired[i])
+		if name == "" {
+			summary.addError(fmt.Sprintf("#%d", i), "no name or address")
+			continue
+		}
+		if wanted[name] {
+			summary.addError(name, "duplicate destination name")
+			continue
+		}
+		desired[i].Name = name
+		wanted[name] = true
+	}
+
+	names := make([]string, 0, len(m.destinationMap))
+	for name := range m.destinationMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !wanted[name] && owned(m.destinationMap[name]) {
+			m.handleDestinationMsgDel(name, false)
+			summary.Removed = append(summary.Removed, name)
+		}
+	}
+
+	for i := range desired {
+		destination := desired[i]
+		if !wanted[destination.Name] {
+			continue
+		}
+		delete(wanted, destination.Name) // only the first one with a name
+		existing, ok := m.destinationMap[destination.Name]
+		if ok && sameConfig(existing, &destination) {
+			summary.Unchanged++
+			continue
+		}
+		if ok {
+			if err := m.updateDestination(existing, destination); err != nil {
+				summary.addError(destination.Name, "%v", err)
+			} else {
+				summary.Updated = append(summary.Updated, destination.Name)
+			}
+			continue
+		}
+		if err := m.addDestination(destination); err != nil {
+			summary.addError(destination.Name, "%v", err)
+		} else {
+			summary.Added = append(summary.Added, destination.Name)
+		}
+	}
+	return summary
+}
+
+// addedViaMqtt tells whether a destination is managed by mqtt bulk updates.
+// Destinations from the config and sources are kept, since they would just be
+// read again from their file on the next reload or restart.
+func addedViaMqtt(destination *Destination) bool {
+	return destination.source == sourceMqtt
+}
+
+func (m *Manager) msgParseDestinations(payload string) {
+	if payload == "" {
+		// likely the removal of a retained message; an empty set must be an empty array
+		return
+	}
+	var entries []interface{}
+	if err := json.Unmarshal([]byte(payload), &entries); err != nil {
+		logger.Warnf("Ignoring destinations: invalid json array: %v", err)
+		summary := &syncSummary{Added: []string{}, Updated: []string{}, Removed: []string{}}
+		summary.addError("", "invalid json array: %v", err)
+		m.publishSyncSummary(summary)
+		return
+	}
+
+	// an invalid entry rejects the whole set, rather than removing the
+	// destination it was meant to replace
+	desired := make([]Destination, 0, len(entries))
+	invalid := &syncSummary{Added: []string{}, Updated: []string{}, Removed: []string{}}
+	for i, entry := range entries {
+		destination, err := decodeDestination(entry)
+		if err != nil {
+			invalid.addError(fmt.Sprintf("#%d", i), "%v", err)
+			continue
+		}
+		destination.source = sourceMqtt
+		desired = append(desired, destination)
+	}
+	if len(invalid.Errors) != 0 {
+		logger.Warnf("Ignoring destinations: %d invalid entries", len(invalid.Errors))
+		m.publishSyncSummary(invalid)
+		return
+	}
+	summary := m.syncDestinations(desired, addedViaMqtt)
+	logger.Infof("Synced destinations: %s", summary)
+	m.publishSyncSummary(summary)
+}
+
+func (m *Manager) publishSyncSummary(summary *syncSummary) {
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		logger.Errorf("Unable to encode destinations summary: %v", err)
+		return
+	}
+	msg := mqtt_agent.Msg{}
+	msg.Topic, msg.Payload = mqtt_agent.MsgPubDestinationsSummary(string(payload))
+	m.mqttPub <- msg
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSameConfig(t *testing.T) {
+	a := &Destination{Name: "nas", Addr: "127.0.0.1", Tags: []string{"lan"}, consecutiveOfflines: 2}
+	b := &Destination{Name: "nas", Addr: "127.0.0.1", Tags: []string{"lan"}, source: sourceMqtt}
+	if !sameConfig(a, b) {
+		t.Fatal("expected runtime fields to be ignored")
+	}
+	b.IntervalSeconds = 10
+	if sameConfig(a, b) {
+		t.Fatal("expected interval change to be detected")
+	}
+}
+
+func TestSyncDestinations(t *testing.T) {
+	m, _ := newTestManager()
+	defer func() {
+		for _, destination := range m.destinationMap {
+			destination.stopProbe()
+		}
+	}()
+	m.addDestination(Destination{Name: "keep", Addr: "127.0.0.1", source: sourceYaml})
+	m.addDestination(Destination{Name: "change", Addr: "127.0.0.1", source: sourceMqtt})
+	m.addDestination(Destination{Name: "drop", Addr: "127.0.0.1", source: sourceMqtt})
+	m.addDestination(Destination{Name: "lease", Addr: "127.0.0.1", source: "file:/leases"})
+	m.addDestination(Destination{Name: "router", Addr: "127.0.0.1", source: sourceYaml})
+
+	summary := m.syncDestinations([]Destination{
+		{Name: "keep", Addr: "127.0.0.1"},
+		{Name: "change", Addr: "127.0.0.1", IntervalSeconds: 30},
+		{Addr: "127.0.0.2"},
+		{Name: "keep", Addr: "127.0.0.3"},
+		{Name: "bad"},
+	}, addedViaMqtt)
+
+	if !reflect.DeepEqual(summary.Added, []string{"127.0.0.2"}) || !reflect.DeepEqual(summary.Updated, []string{"change"}) ||
+		!reflect.DeepEqual(summary.Removed, []string{"drop"}) || summary.Unchanged != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if _, ok := summary.Errors["keep"]; !ok || len(summary.Errors) != 2 {
+		t.Fatalf("expected errors for duplicate and invalid destinations, got %v", summary.Errors)
+	}
+	if _, ok := m.destinationMap["lease"]; !ok {
+		t.Fatal("expected destination from file source to be kept")
+	}
+	if _, ok := m.destinationMap["router"]; !ok {
+		t.Fatal("expected destination from config to be kept")
+	}
+	if m.destinationMap["change"].IntervalSeconds != 30 {
+		t.Fatal("expected changed destination to be replaced")
+	}
+}
+
+func TestSyncRejectsInvalidEntries(t *testing.T) {
+	m, pub := newTestManager()
+	defer func() {
+		for _, destination := range m.destinationMap {
+			destination.stopProbe()
+		}
+	}()
+	m.addDestination(Destination{Name: "nas", Addr: "127.0.0.1", source: sourceMqtt})
+	m.addDestination(Destination{Name: "tv", Addr: "127.0.0.1", source: sourceMqtt})
+	nas := m.destinationMap["nas"]
+	for len(pub) > 0 {
+		<-pub
+	}
+
+	// a typo in the replacement of nas must not remove it
+	m.msgParseDestinations(`[{"name":"nas","adress":"127.0.0.1"},{"name":"new","address":"127.0.0.1"}]`)
+
+	if m.destinationMap["nas"] != nas || m.destinationMap["tv"] == nil || m.destinationMap["new"] != nil {
+		t.Fatalf("expected nothing to change, got %v", m.destinationMap)
+	}
+	msg := <-pub
+	var summary syncSummary
+	if err := json.Unmarshal([]byte(msg.Payload), &summary); err != nil {
+		t.Fatalf("unexpected summary %s: %v", msg.Payload, err)
+	}
+	if _, ok := summary.Errors["#0"]; !ok || len(summary.Errors) != 1 || len(summary.Removed) != 0 {
+		t.Fatalf("expected only the invalid entry in the summary, got %+v", summary)
+	}
+	if len(pub) != 0 {
+		t.Fatalf("expected only the summary to be published, got %d more", len(pub))
+	}
+}
@@ -0,0 +1,156 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/flavio-fernandes/mqtt2ping/internal/mqtt_agent"
+)
+
+// toJson returns the configurable fields of the destination in the format used
+// by the destination topics
+func (d *Destination) toJson() destinationJson {
+	return destinationJson{
+		Address:     d.Addr,
+		Interval:    d.IntervalSeconds,
+		Type:        d.Type,
+		Targets:     d.Targets,
+		DependsOn:   d.DependsOn,
+		Tags:        d.Tags,
+		Maintenance: d.Maintenance,
+		Schedule:    d.Schedule,
+	}
+}
+
+// mergePatch applies a json merge patch (RFC 7386) to target and returns the result
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+		} else {
+			targetObj[k] = mergePatch(targetObj[k], v)
+		}
+	}
+	return targetObj
+}
+
+// patchDestination returns the config of the destination with the merge patch applied
+func patchDestination(destination *Destination, patch string) (Destination, error) {
+	var patchValue interface{}
+	if err := json.Unmarshal([]byte(patch), &patchValue); err != nil {
+		return Destination{}, fmt.Errorf("invalid json: %w", err)
+	}
+	if _, ok := patchValue.(map[string]interface{}); !ok {
+		return Destination{}, fmt.Errorf("patch must be a json object")
+	}
+
+	current, _ := json.Marshal(destination.toJson())
+	var currentValue interface{}
+	_ = json.Unmarshal(current, &currentValue)
+
+	updated, err := decodeDestination(mergePatch(currentValue, patchValue))
+	if err != nil {
+		return Destination{}, fmt.Errorf("invalid patch: %w", err)
+	}
+	updated.Name = destination.Name
+	updated.source = destination.source
+	return updated, nil
+}
+
+// updateDestination applies the config of updated to the existing destination
+// in place, keeping its counters and state. Its pingers are only rebuilt when
+// what gets pinged changes, or restarted when the interval changes.
+func (m *Manager) updateDestination(destination *Destination, updated Destination) error {
+	if sameConfig(destination, &updated) {
+		return nil
+	}
+	addrs, err := updated.probeAddrs()
+	if err != nil {
+		return err
+	}
+	if err = m.parseDestinationOptions(&updated); err != nil {
+		return err
+	}
+
+	targetChanged := destination.Addr != updated.Addr || destination.Type != updated.Type ||
+		!reflect.DeepEqual(destination.Targets, updated.Targets)
+	intervalChanged := destination.interval != updated.interval
+
+	wasProbing := destination.isProbing()
+	if wasProbing && (targetChanged || intervalChanged) {
+		oldAddrs, oldInterval := destination.targetAddrs, destination.interval
+		destination.stopProbe()
+		destination.interval = updated.interval
+		if err = destination.startProbe(addrs); err != nil {
+			// leave the destination as it was
+			destination.interval = oldInterval
+			if restartErr := destination.startProbe(oldAddrs); restartErr != nil {
+				logger.Errorf("Unable to restart pinger for destination %s: %v", destination.Name, restartErr)
+			}
+			return err
+		}
+	}
+	destination.Addr = updated.Addr
+	destination.IntervalSeconds = updated.IntervalSeconds
+	destination.Type = updated.Type
+	destination.Targets = updated.Targets
+	destination.DependsOn = updated.DependsOn
+	destination.Tags = updated.Tags
+	destination.Maintenance = updated.Maintenance
+	destination.Schedule = updated.Schedule
+	destination.interval = updated.interval
+	destination.maintenanceWindows = updated.maintenanceWindows
+	destination.activeHours = updated.activeHours
+
+	if targetChanged {
+		// a different target needs its state to be determined again
+		destination.setState("")
+		destination.lastIsOnline = false
+		destination.consecutiveOfflines = 0
+		destination.downSince = time.Time{}
+	}
+	destination.inactive = destination.activeHours != nil && !destination.activeHours.active(time.Now())
+	m.updateProbing(destination, wasProbing)
+
+	logger.Infof("Updated destination %s (target changed: %t interval changed: %t)",
+		destination.Name, targetChanged, intervalChanged)
+	m.publishDestination(destination)
+	return nil
+}
+
+func (m *Manager) msgParseSet(topic, payload string) {
+	name, ok := mqtt_agent.GetTopicSubDestinationSet(topic)
+	if !ok {
+		logger.Errorf("Unexpected parsing of topic: %s", topic)
+		return
+	}
+	if payload == "" {
+		// likely the removal of a retained message
+		return
+	}
+	destination, ok := m.destinationMap[name]
+	if !ok {
+		logger.Warnf("Ignoring update of destination %s: not-found", name)
+		m.publishResult(name, "set", payload, errNotFound)
+		return
+	}
+	updated, err := patchDestination(destination, payload)
+	if err == nil {
+		err = m.updateDestination(destination, updated)
+	}
+	if err != nil {
+		logger.Warnf("Ignoring update of destination %s: %v", name, err)
+	}
+	m.publishResult(name, "set", payload, err)
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPatchDestination(t *testing.T) {
+	destination := &Destination{Name: "nas", Addr: "127.0.0.1", IntervalSeconds: 10, Tags: []string{"lan"},
+		Schedule: &Schedule{Days: []string{"mon"}, Timezone: "UTC"}, source: sourceYaml}
+
+	updated, err := patchDestination(destination, `{"tags": ["lan", "storage"], "interval": null, "schedule": {"timezone": null}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Destination{Name: "nas", Addr: "127.0.0.1", Tags: []string{"lan", "storage"},
+		Schedule: &Schedule{Days: []string{"mon"}}, source: sourceYaml}
+	if !reflect.DeepEqual(updated, expected) {
+		t.Fatalf("unexpected patched destination:\n%+v\nexpected:\n%+v", updated, expected)
+	}
+
+	for _, patch := range []string{`[]`, `{"interval": "soon"}`, `{`} {
+		if _, err = patchDestination(destination, patch); err == nil {
+			t.Fatalf("expected error applying %s", patch)
+		}
+	}
+}
+
+func TestUpdateDestinationKeepsState(t *testing.T) {
+	m, _ := newTestManager()
+	m.addDestination(Destination{Name: "nas", Addr: "127.0.0.1"})
+	destination := m.destinationMap["nas"]
+	defer destination.stopProbe()
+	destination.packetsSent, destination.packetsRecv, destination.state = 10, 9, "online"
+	pingers := destination.pingers
+
+	if err := m.updateDestination(destination, Destination{Name: "nas", Addr: "127.0.0.1", Tags: []string{"lan"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if destination.pingers[0] != pingers[0] || destination.packetsSent != 10 || destination.state != "online" {
+		t.Fatal("expected tag change to be applied in place")
+	}
+
+	if err := m.updateDestination(destination, Destination{Name: "nas", Addr: "127.0.0.2", Tags: []string{"lan"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if destination.targetAddrs[0] != "127.0.0.2" || destination.packetsRecv != 9 || destination.state != "" {
+		t.Fatalf("expected new target with counters kept and state reset: %+v", destination)
+	}
+	if m.destinationMap["nas"] != destination {
+		t.Fatal("expected destination to be updated in place")
+	}
+}
+
+func TestInvalidReplacementKeepsDestination(t *testing.T) {
+	m, pub := newTestManager()
+	defer func() {
+		for _, destination := range m.destinationMap {
+			destination.stopProbe()
+		}
+	}()
+	if err := m.addDestination(Destination{Name: "nas", Addr: "127.0.0.1", source: sourceYaml}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nas := m.destinationMap["nas"]
+	nas.packetsSent = 42
+
+	for _, payload := range []string{
+		`{"address":"127.0.0.1","intervl":5}`,
+		`{"address":"127.0.0.1","schedule":{"days":["someday"]}}`,
+		`{"address":"no.such.host.invalid"}`,
+		`{"address":"127.0.0.1","interval":-1}`,
+	} {
+		if err := m.handleDestinationMsgAdd("nas", payload); err == nil {
+			t.Fatalf("expected error for %s", payload)
+		}
+		if m.destinationMap["nas"] != nas || !nas.isProbing() || nas.packetsSent != 42 {
+			t.Fatalf("destination changed by rejected replacement %s: %+v", payload, nas)
+		}
+	}
+
+	if err := m.handleDestinationMsgAdd("nas", `{"address":"127.0.0.1","interval":5}`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.destinationMap["nas"] != nas || nas.IntervalSeconds != 5 || nas.source != sourceMqtt {
+		t.Fatalf("unexpected replaced destination: %+v", nas)
+	}
+	for len(pub) > 0 {
+		<-pub
+	}
+}
+
+func TestNegativeIntervalRejected(t *testing.T) {
+	m, _ := newTestManager()
+	if err := m.handleDestinationMsgAdd("nas", `{"address":"127.0.0.1","interval":-1}`); err == nil {
+		t.Fatal("expected error adding a destination with a negative interval")
+	}
+	if _, ok := m.destinationMap["nas"]; ok {
+		t.Fatal("expected the destination not to be added")
+	}
+
+	if err := m.addDestination(Destination{Name: "nas", Addr: "127.0.0.1", IntervalSeconds: 5}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nas := m.destinationMap["nas"]
+	defer nas.stopProbe()
+	updated, err := patchDestination(nas, `{"interval": -5}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = m.updateDestination(nas, updated); err == nil {
+		t.Fatal("expected error patching a negative interval")
+	}
+	if nas.IntervalSeconds != 5 || !nas.isProbing() {
+		t.Fatalf("destination changed by rejected patch: %+v", nas)
+	}
+}
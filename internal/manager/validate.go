@@ -0,0 +1,253 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+)
+
+// lookupHost resolves hostnames while validating; replaced by tests
+var lookupHost = net.LookupHost
+
+// configProblem is something wrong found while validating a config file. Line is
+// 0 when it cannot be told.
+type configProblem struct {
+	Line    int
+	Message string
+}
+
+// validation collects the problems of a config file, using its yaml nodes to
+// tell their lines
+type validation struct {
+	filename string
+	root     *yaml.Node
+	problems []configProblem
+}
+
+var pathSegment = regexp.MustCompile(`^([^\[]*)((?:\[\d+\])*)$`)
+
+// nodeAt returns the yaml node of a mapstructure key path, like "destinations[0].interval".
+// For a mapping key, its key node is returned. It returns nil if there is no such node.
+func nodeAt(root *yaml.Node, path string) *yaml.Node {
+	node := root
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	var keyNode *yaml.Node
+	for _, segment := range strings.Split(path, ".") {
+		match := pathSegment.FindStringSubmatch(segment)
+		if match == nil || node == nil {
+			return nil
+		}
+		if match[1] != "" {
+			keyNode = nil
+			if node.Kind != yaml.MappingNode {
+				return nil
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if strings.EqualFold(node.Content[i].Value, match[1]) {
+					keyNode, node = node.Content[i], node.Content[i+1]
+					break
+				}
+			}
+			if keyNode == nil {
+				return nil
+			}
+		}
+		for _, index := range strings.Split(strings.Trim(match[2], "[]"), "][") {
+			if index == "" {
+				continue
+			}
+			i, _ := strconv.Atoi(index)
+			if node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+				return nil
+			}
+			keyNode, node = nil, node.Content[i]
+		}
+	}
+	if keyNode != nil {
+		return keyNode
+	}
+	return node
+}
+
+func (v *validation) addf(path, format string, args ...interface{}) {
+	problem := configProblem{Message: fmt.Sprintf(format, args...)}
+	if node := nodeAt(v.root, path); path != "" && node != nil {
+		problem.Line = node.Line
+	}
+	v.problems = append(v.problems, problem)
+}
+
+// checkAddr reports an address that is not an ip and cannot be resolved
+func (v *validation) checkAddr(path, addr string) {
+	if net.ParseIP(addr) != nil {
+		return
+	}
+	if _, err := lookupHost(addr); err != nil {
+		v.addf(path, "unable to resolve address %q: %v", addr, err)
+	}
+}
+
+func (v *validation) checkSettings(d *Destinations) {
+	if d.DefaultIntervalSeconds < 0 {
+		v.addf("interval", "invalid interval %d", d.DefaultIntervalSeconds)
+	}
+	if d.AdvertisementsSeconds < 0 {
+		v.addf("advertisements", "invalid advertisements %d", d.AdvertisementsSeconds)
+	}
+	if d.UpdateStatusIntervalSeconds < 0 {
+		v.addf("update-interval", "invalid update-interval %d", d.UpdateStatusIntervalSeconds)
+	} else if d.UpdateStatusIntervalSeconds > 0 && d.UpdateStatusIntervalSeconds < minUpdateStatusIntervalSeconds {
+		v.addf("update-interval", "update-interval %d is less than %d, which is used instead",
+			d.UpdateStatusIntervalSeconds, minUpdateStatusIntervalSeconds)
+	}
+	if d.DependencyMode != "" {
+		if err := validDependencyMode(d.DependencyMode); err != nil {
+			v.addf("dependency-mode", "%v", err)
+		}
+	}
+	if d.Outage != nil && (d.Outage.ThresholdPercent < 0 || d.Outage.ThresholdPercent > 100) {
+		v.addf("outage.threshold", "outage threshold %d is not a percentage", d.Outage.ThresholdPercent)
+	}
+	for i := range d.Sources {
+		if err := validateSource(&d.Sources[i]); err != nil {
+			v.addf(fmt.Sprintf("sources[%d]", i), "%v", err)
+		}
+	}
+}
+
+// location returns where the yaml node of a key path is, as "file:line"
+func (v *validation) location(path string) string {
+	if node := nodeAt(v.root, path); node != nil {
+		return fmt.Sprintf("%s:%d", v.filename, node.Line)
+	}
+	return v.filename
+}
+
+// checkDestinations checks the destinations of a config file. The names are the ones
+// of all config files, and seen tells where the destinations checked so far are.
+func (v *validation) checkDestinations(destinations []Destination, names map[string]bool, seen map[string]string) {
+	m := &Manager{defaultIntervalSeconds: defaultIntervalSeconds}
+	for i := range destinations {
+		destination := destinations[i]
+		path := fmt.Sprintf("destinations[%d]", i)
+		name := destinationName(&destination)
+		if name == "" {
+			v.addf(path, "destination has no name or address")
+			continue
+		}
+		if location, ok := seen[name]; ok {
+			v.addf(path, "duplicate destination name %s, already defined at %s", name, location)
+		} else {
+			seen[name] = v.location(path)
+		}
+
+		switch destination.Type {
+		case "", destinationTypePing:
+			if destination.Addr == "" {
+				v.addf(path, "destination %s has no address", name)
+			} else {
+				v.checkAddr(path+".address", destination.Addr)
+			}
+		case destinationTypeGateway:
+			// depends on where it runs
+		case destinationTypeInternet:
+			for j, target := range destination.Targets {
+				v.checkAddr(fmt.Sprintf("%s.targets[%d]", path, j), target)
+			}
+		default:
+			v.addf(path+".type", "destination %s has unknown type %q", name, destination.Type)
+		}
+
+		if destination.IntervalSeconds < 0 {
+			v.addf(path+".interval", "destination %s has invalid interval %d", name, destination.IntervalSeconds)
+			destination.IntervalSeconds = 0 // reported with its line, check the rest
+		}
+		if err := m.parseDestinationOptions(&destination); err != nil {
+			v.addf(path, "destination %s: %v", name, err)
+		}
+		for _, parent := range destination.DependsOn {
+			if !names[parent] {
+				v.addf(path+".depends_on", "destination %s depends on unknown destination %s", name, parent)
+			}
+		}
+	}
+}
+
+func (v *validation) formatProblems() []string {
+	problems := make([]string, 0, len(v.problems))
+	for _, problem := range v.problems {
+		if problem.Line > 0 {
+			problems = append(problems, fmt.Sprintf("%s:%d: %s", v.filename, problem.Line, problem.Message))
+		} else {
+			problems = append(problems, fmt.Sprintf("%s: %s", v.filename, problem.Message))
+		}
+	}
+	return problems
+}
+
+// ValidateConfig checks a config more strictly than it is read when running: unknown
+// keys, invalid values, duplicate names and addresses that cannot be resolved are
+// reported, each as "file:line: problem". A config directory and included files are
+// checked as well. The error is set when a file cannot be read or parsed at all.
+func ValidateConfig(configPath string) ([]string, error) {
+	filenames, err := configFiles(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	validations := make([]*validation, 0, len(filenames))
+	configs := make([]*Destinations, 0, len(filenames))
+	names := make(map[string]bool)
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s: %w", filename, err)
+		}
+		var root yaml.Node
+		if err = yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("unable to parse yaml %s: %w", filename, err)
+		}
+		var raw interface{}
+		if err = root.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("unable to parse yaml %s: %w", filename, err)
+		}
+
+		v := &validation{filename: filename, root: &root}
+		if expanded, err := expandValue(raw); err != nil {
+			v.addf("", "%v", err)
+		} else {
+			raw = expanded
+		}
+		d := &Destinations{}
+		metadata := &mapstructure.Metadata{}
+		decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{WeaklyTypedInput: true, Result: d, Metadata: metadata})
+		if err = decoder.Decode(raw); err != nil {
+			v.addf("", "%v", err)
+		}
+		for _, key := range metadata.Unused {
+			v.addf(key, "unknown key %s", key)
+		}
+		for i := range d.Destinations {
+			names[destinationName(&d.Destinations[i])] = true
+		}
+		validations = append(validations, v)
+		configs = append(configs, d)
+	}
+
+	problems := []string{}
+	seen := make(map[string]string)
+	for i, v := range validations {
+		v.checkSettings(configs[i])
+		v.checkDestinations(configs[i].Destinations, names, seen)
+		problems = append(problems, v.formatProblems()...)
+	}
+	return problems, nil
+}
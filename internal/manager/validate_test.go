@@ -0,0 +1,77 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestNodeAt(t *testing.T) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte("interval: 3\ndestinations:\n  - name: a\n    targets: [1.1.1.1, 8.8.8.8]\n  - name: b\n"), &root); err != nil {
+		t.Fatal(err)
+	}
+	for path, line := range map[string]int{
+		"interval":                   1,
+		"destinations[1]":            5,
+		"destinations[0].targets[1]": 4,
+		"destinations[0].NAME":       3,
+	} {
+		if node := nodeAt(&root, path); node == nil || node.Line != line {
+			t.Fatalf("nodeAt(%q) = %+v, expected line %d", path, node, line)
+		}
+	}
+	for _, path := range []string{"bogus", "destinations[2]", "interval[0]"} {
+		if node := nodeAt(&root, path); node != nil {
+			t.Fatalf("nodeAt(%q) = %+v, expected nil", path, node)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	defer func(orig func(string) ([]string, error)) { lookupHost = orig }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		if host == "nas.lan" {
+			return []string{"192.168.1.5"}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+
+	configFilename := filepath.Join(t.TempDir(), "config.yaml")
+	config := `update-interval: 1
+destinations:
+  - address: nas.lan
+    intreval: 10
+  - address: 192.168.1.6
+    name: nas.lan
+  - address: printer.lan
+    interval: -5
+    depends_on: [router]
+`
+	if err := os.WriteFile(configFilename, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := ValidateConfig(configFilename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		configFilename + ":4: unknown key destinations[0].intreval",
+		configFilename + ":1: update-interval 1 is less than 2, which is used instead",
+		configFilename + ":5: duplicate destination name nas.lan, already defined at " + configFilename + ":3",
+		configFilename + ":7: unable to resolve address \"printer.lan\": no such host",
+		configFilename + ":8: destination printer.lan has invalid interval -5",
+		configFilename + ":9: destination printer.lan depends on unknown destination router",
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("unexpected problems:\n%q\nexpected:\n%q", problems, expected)
+	}
+
+	if _, err = ValidateConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"time"
+)
+
+// statsWindow is how far back the windowed packet counters of a destination go
+const statsWindow = time.Hour
+
+// statsSample is the packet counters of a destination at a status update. The
+// windowed stats are the difference between the latest and the oldest sample.
+type statsSample struct {
+	At              time.Time `json:"at"`
+	PacketsSent     int       `json:"packets_sent"`
+	PacketsReceived int       `json:"packets_received"`
+}
+
+// recordStats adds a sample of the packet counters and drops the ones no longer
+// needed. The newest sample older than the window is kept, so the window is full.
+func (d *Destination) recordStats(now time.Time) {
+	d.statsSamples = append(d.statsSamples,
+		statsSample{At: now, PacketsSent: d.packetsSent, PacketsReceived: d.packetsRecv})
+	start := now.Add(-statsWindow)
+	drop := 0
+	for drop+1 < len(d.statsSamples) && !d.statsSamples[drop+1].At.After(start) {
+		drop++
+	}
+	d.statsSamples = d.statsSamples[drop:]
+}
+
+// windowStats returns how many packets were sent and received within the window
+func (d *Destination) windowStats() (sent, received int) {
+	if len(d.statsSamples) == 0 {
+		return 0, 0
+	}
+	first, last := d.statsSamples[0], d.statsSamples[len(d.statsSamples)-1]
+	return last.PacketsSent - first.PacketsSent, last.PacketsReceived - first.PacketsReceived
+}
+
+// windowLoss returns the percentage of packets lost within the window
+func (d *Destination) windowLoss() float64 {
+	sent, received := d.windowStats()
+	if sent <= 0 {
+		return 0
+	}
+	return float64(sent-received) * 100 / float64(sent)
+}
+
+// setState changes the state of the destination, noting since when it has it
+func (d *Destination) setState(state string) {
+	if state != d.state {
+		d.stateSince = time.Now()
+	}
+	d.state = state
+}
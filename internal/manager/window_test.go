@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordStats(t *testing.T) {
+	start := time.Date(2030, 1, 1, 8, 0, 0, 0, time.UTC)
+	d := &Destination{Name: "nas"}
+	for i := 0; i <= 90; i++ {
+		// one packet a minute, the last half hour all lost
+		d.packetsSent = i
+		d.packetsRecv = min(i, 60)
+		d.recordStats(start.Add(time.Duration(i) * time.Minute))
+	}
+	if !d.statsSamples[0].At.Equal(start.Add(30 * time.Minute)) {
+		t.Fatalf("expected the window to start an hour back, got %v", d.statsSamples[0].At)
+	}
+	if sent, received := d.windowStats(); sent != 60 || received != 30 {
+		t.Fatalf("unexpected window stats: sent %d received %d", sent, received)
+	}
+	if loss := d.windowLoss(); loss != 50 {
+		t.Fatalf("expected 50%% loss, got %.0f%%", loss)
+	}
+}
+
+func TestWindowLossWithoutPackets(t *testing.T) {
+	d := &Destination{Name: "nas"}
+	if loss := d.windowLoss(); loss != 0 {
+		t.Fatalf("expected no loss, got %.0f%%", loss)
+	}
+	d.recordStats(time.Now())
+	if loss := d.windowLoss(); loss != 0 {
+		t.Fatalf("expected no loss, got %.0f%%", loss)
+	}
+}
+
+func TestSetState(t *testing.T) {
+	d := &Destination{Name: "nas", state: "offline"}
+	d.setState("online")
+	since := d.stateSince
+	if d.state != "online" || since.IsZero() {
+		t.Fatalf("unexpected destination: %+v", d)
+	}
+	d.setState("online")
+	if !d.stateSince.Equal(since) {
+		t.Fatalf("expected the same state to keep its since time")
+	}
+}
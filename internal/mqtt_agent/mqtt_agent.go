@@ -3,6 +3,8 @@ package mqtt_agent
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/antigloss/go/logger"
@@ -10,8 +12,9 @@ import (
 )
 
 type Msg struct {
-	Topic   string
-	Payload string
+	Topic    string
+	Payload  string
+	Retained bool
 }
 
 type Config struct {
@@ -20,6 +23,7 @@ type Config struct {
 	User        string
 	Pass        string
 	TopicPrefix string
+	Retain      bool // subscribe to the retained state and info topics, until StopReadingRetained
 }
 
 const (
@@ -33,9 +37,40 @@ const (
 const (
 	defTopicSubStatus            = "status"
 	defTopicSubDestinationConfig = "destination"
+	defTopicSubSilence           = "silence"
+	defTopicSubPing              = "ping"
+	defTopicSubCommand           = "command"
+	defTopicSubDestinations      = "destinations"
+	defTopicSubSettings          = "settings"
+	defTopicSubExport            = "export"
+	defTopicSubImport            = "import"
+
+	defTopicPubAdvState  = "state/"
+	defTopicPubAdvInfo   = "info/"
+	defTopicPubOutage    = "outage"
+	defTopicPubReload    = "reload"
+	defTopicPubConfig    = "config/"
+	defTopicPubInventory = "inventory"
+	defTopicPubResult    = "result/"
+	defTopicPubSchema    = "schema/destination"
+	defTopicPubSnapshot  = "snapshot"
+
+	defTopicSubDestinationSetSuffix = "/set"
+
+	defTopicPubPingResultSuffix    = "/result"
+	defTopicPubDestinationsSummary = "destinations/summary"
+	defTopicPubSettingsEffective   = "settings/effective"
+)
 
-	defTopicPubAdvState = "state/"
-	defTopicPubAdvInfo  = "info/"
+// Values published on the state topic of a destination
+const (
+	StateOnline      = "online"
+	StateOffline     = "offline"
+	StateUnreachable = "unreachable" // offline, but so is a destination it depends on
+	StateMaintenance = "maintenance" // offline, during a maintenance window or silence
+	StateInactive    = "inactive"    // not pinged, outside of its schedule
+	StatePaused      = "paused"      // not pinged, paused by a command
+	StateUnknown     = "unknown"     // not determined yet, since it was added
 )
 
 func topicSubStatus() string {
@@ -50,6 +85,42 @@ func topicSubDestinationConfig() string {
 	return gConf.TopicPrefix + defTopicSubDestinationConfig + "/#"
 }
 
+func topicSubDestinationSilence() string {
+	return gConf.TopicPrefix + defTopicSubSilence + "/#"
+}
+
+func topicSubPing() string {
+	return gConf.TopicPrefix + defTopicSubPing + "/#"
+}
+
+func topicSubDestinationCommand() string {
+	return gConf.TopicPrefix + defTopicSubCommand + "/#"
+}
+
+func topicSubDestinations() string {
+	return gConf.TopicPrefix + defTopicSubDestinations
+}
+
+func topicSubSettings() string {
+	return gConf.TopicPrefix + defTopicSubSettings
+}
+
+func topicSubExport() string {
+	return gConf.TopicPrefix + defTopicSubExport
+}
+
+func topicSubImport() string {
+	return gConf.TopicPrefix + defTopicSubImport
+}
+
+func topicSubAdvState() string {
+	return gConf.TopicPrefix + defTopicPubAdvState + "#"
+}
+
+func topicSubAdvInfo() string {
+	return gConf.TopicPrefix + defTopicPubAdvInfo + "#"
+}
+
 func GetTopicSubStatus(topic string) string {
 	if _, ok := GetTopicSubDestinationStatus(topic); ok {
 		return topic
@@ -64,6 +135,70 @@ func GetTopicSubConfig(topic string) string {
 	return ""
 }
 
+func GetTopicSubSilence(topic string) string {
+	if _, ok := GetTopicSubDestinationSilence(topic); ok {
+		return topic
+	}
+	return ""
+}
+
+// GetTopicSubPing matches ping requests as well as their results
+func GetTopicSubPing(topic string) string {
+	if _, ok := extractTopicSuffix(topic, defTopicSubPing); ok {
+		return topic
+	}
+	return ""
+}
+
+func GetTopicSubCommand(topic string) string {
+	if _, ok := GetTopicSubDestinationCommand(topic); ok {
+		return topic
+	}
+	return ""
+}
+
+func GetTopicSubDestinations(topic string) string {
+	if topic == topicSubDestinations() {
+		return topic
+	}
+	return ""
+}
+
+func GetTopicSubSettings(topic string) string {
+	if topic == topicSubSettings() {
+		return topic
+	}
+	return ""
+}
+
+func GetTopicSubExport(topic string) string {
+	if topic == topicSubExport() {
+		return topic
+	}
+	return ""
+}
+
+func GetTopicSubImport(topic string) string {
+	if topic == topicSubImport() {
+		return topic
+	}
+	return ""
+}
+
+func GetTopicSubAdvState(topic string) string {
+	if _, ok := GetTopicSubDestinationAdvState(topic); ok {
+		return topic
+	}
+	return ""
+}
+
+func GetTopicSubAdvInfo(topic string) string {
+	if _, ok := GetTopicSubDestinationAdvInfo(topic); ok {
+		return topic
+	}
+	return ""
+}
+
 func GetTopicSubDestinationStatus(topic string) (string, bool) {
 	// All destinations
 	if topic == topicSubStatus() {
@@ -74,7 +209,57 @@ func GetTopicSubDestinationStatus(topic string) (string, bool) {
 }
 
 func GetTopicSubDestinationConfig(topic string) (string, bool) {
-	return extractTopicSuffix(topic, defTopicSubDestinationConfig)
+	name, ok := extractTopicSuffix(topic, defTopicSubDestinationConfig)
+	if !ok || strings.HasSuffix(name, defTopicSubDestinationSetSuffix) {
+		return "", false
+	}
+	return name, true
+}
+
+func GetTopicSubSet(topic string) string {
+	if _, ok := GetTopicSubDestinationSet(topic); ok {
+		return topic
+	}
+	return ""
+}
+
+// GetTopicSubDestinationSet returns the destination name of a partial update topic:
+// destination/<name>/set
+func GetTopicSubDestinationSet(topic string) (string, bool) {
+	name, ok := extractTopicSuffix(topic, defTopicSubDestinationConfig)
+	if !ok || !strings.HasSuffix(name, defTopicSubDestinationSetSuffix) {
+		return "", false
+	}
+	name = strings.TrimSuffix(name, defTopicSubDestinationSetSuffix)
+	return name, name != ""
+}
+
+func GetTopicSubDestinationSilence(topic string) (string, bool) {
+	return extractTopicSuffix(topic, defTopicSubSilence)
+}
+
+// GetTopicSubPingId returns the request id of a ping topic. Result topics, which
+// we publish ourselves under the same prefix, are not requests.
+func GetTopicSubPingId(topic string) (string, bool) {
+	id, ok := extractTopicSuffix(topic, defTopicSubPing)
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+func GetTopicSubDestinationCommand(topic string) (string, bool) {
+	return extractTopicSuffix(topic, defTopicSubCommand)
+}
+
+// GetTopicSubDestinationAdvState returns the destination of a state topic we publish
+func GetTopicSubDestinationAdvState(topic string) (string, bool) {
+	return extractTopicSuffix(topic, strings.TrimSuffix(defTopicPubAdvState, "/"))
+}
+
+// GetTopicSubDestinationAdvInfo returns the destination of an info topic we publish
+func GetTopicSubDestinationAdvInfo(topic string) (string, bool) {
+	return extractTopicSuffix(topic, strings.TrimSuffix(defTopicPubAdvInfo, "/"))
 }
 
 func extractTopicSuffix(topic, topicPrefix string) (string, bool) {
@@ -88,19 +273,68 @@ func extractTopicSuffix(topic, topicPrefix string) (string, bool) {
 
 func onlineStr(on bool) string {
 	if on {
-		return "online"
+		return StateOnline
 	}
-	return "offline"
+	return StateOffline
 }
 
 func MsgPubAdvState(name string, isOnline bool) (string, string) {
-	return gConf.TopicPrefix + defTopicPubAdvState + name, onlineStr(isOnline)
+	return MsgPubAdvStateValue(name, onlineStr(isOnline))
+}
+
+func MsgPubAdvStateValue(name, state string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubAdvState + name, state
 }
 
 func MsgPubAdvInfo(name, info string) (string, string) {
 	return gConf.TopicPrefix + defTopicPubAdvInfo + name, info
 }
 
+func MsgPubOutage(info string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubOutage, info
+}
+
+func MsgPubConfig(name, config string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubConfig + name, config
+}
+
+// MsgPubDestinationConfig is the topic destinations are added on, to move or clear a retained one
+func MsgPubDestinationConfig(name, payload string) (string, string) {
+	return gConf.TopicPrefix + defTopicSubDestinationConfig + "/" + name, payload
+}
+
+func MsgPubResult(name, result string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubResult + name, result
+}
+
+func MsgPubSchema(schema string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubSchema, schema
+}
+
+func MsgPubSnapshot(snapshot string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubSnapshot, snapshot
+}
+
+func MsgPubInventory(inventory string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubInventory, inventory
+}
+
+func MsgPubSettingsEffective(settings string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubSettingsEffective, settings
+}
+
+func MsgPubReload(result string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubReload, result
+}
+
+func MsgPubPingResult(id, result string) (string, string) {
+	return gConf.TopicPrefix + defTopicSubPing + "/" + id + defTopicPubPingResultSuffix, result
+}
+
+func MsgPubDestinationsSummary(summary string) (string, string) {
+	return gConf.TopicPrefix + defTopicPubDestinationsSummary, summary
+}
+
 func FirstN(s string, n int) string {
 	r := []rune(s)
 	if len(r) > n {
@@ -158,7 +392,13 @@ func connectionWorker(connectionQueue <-chan bool) {
 	}
 	logger.Trace("connectionWorker connected and got connect callback")
 
-	for _, topic := range gMqttTopics {
+	topics := gMqttTopics
+	select {
+	case <-gRetainedDone:
+	default:
+		topics = append(topics[:len(topics):len(topics)], gRetainedTopics...)
+	}
+	for _, topic := range topics {
 		token := gClient.Subscribe(topic, 0, nil)
 		if !token.WaitTimeout(20*time.Second) || token.Error() != nil {
 			logger.Warnf("connectionWorker was unable to subscribe to %s: %s",
@@ -167,11 +407,25 @@ func connectionWorker(connectionQueue <-chan bool) {
 		}
 		logger.Trace("connectionWorker subscribed to", topic)
 	}
+	gSubscribedOnce.Do(func() { close(gSubscribed) })
 
+	retainedDone := gRetainedDone
+	if len(topics) == len(gMqttTopics) {
+		retainedDone = nil // not subscribed to them
+	}
 	for isConnected {
 		select {
 		case isConnected = <-connectionQueue:
 			logger.Info("connectionWorker got connection callback", isConnected)
+		case <-retainedDone:
+			retainedDone = nil
+			token := gClient.Unsubscribe(gRetainedTopics...)
+			if !token.WaitTimeout(20*time.Second) || token.Error() != nil {
+				logger.Warnf("connectionWorker was unable to unsubscribe from %v: %s",
+					gRetainedTopics, token.Error())
+				continue
+			}
+			logger.Trace("connectionWorker unsubscribed from", gRetainedTopics)
 		case <-time.After(180 * time.Second):
 			logger.Trace("connectionWorker happy loop")
 		}
@@ -187,11 +441,11 @@ func mqttMessageWorker(mqttSubMsgChannel chan<- Msg, mqttPubMsgChannel <-chan Ms
 	for {
 		select {
 		case mqttMsg = <-gMessageQueue:
-			msg = Msg{mqttMsg.Topic(), string(mqttMsg.Payload())}
+			msg = Msg{Topic: mqttMsg.Topic(), Payload: string(mqttMsg.Payload()), Retained: mqttMsg.Retained()}
 			logger.Tracef("mqttMessageWorker received %s %q...", msg.Topic, FirstN(msg.Payload, 10))
 			mqttSubMsgChannel <- msg
 		case msg = <-mqttPubMsgChannel:
-			token := gClient.Publish(msg.Topic, 0, false, msg.Payload)
+			token := gClient.Publish(msg.Topic, 0, msg.Retained, msg.Payload)
 			if token.WaitTimeout(10 * time.Second) {
 				logger.Tracef("mqttMessageWorker sent %+v", msg)
 				time.Sleep(500 * time.Millisecond)
@@ -211,10 +465,21 @@ func Start(config *Config, mqttSubMsgChannel chan<- Msg) chan<- Msg {
 		topicSubStatus,
 		topicSubDestinationStatus,
 		topicSubDestinationConfig,
+		topicSubDestinationSilence,
+		topicSubPing,
+		topicSubDestinationCommand,
+		topicSubDestinations,
+		topicSubSettings,
+		topicSubExport,
+		topicSubImport,
 	}
 	for _, subFunc := range subFuncs {
 		gMqttTopics = append(gMqttTopics, subFunc())
 	}
+	if gConf.Retain {
+		// to read back what we published before a restart
+		gRetainedTopics = []string{topicSubAdvState(), topicSubAdvInfo()}
+	}
 
 	go connectionWorker(gConnectionQueue)
 	go mqttMessageWorker(mqttSubMsgChannel, mqttPubMsgChannel)
@@ -242,6 +507,26 @@ var gConf Config
 var gClient MQTT.Client
 var gMessageQueue = make(chan MQTT.Message, 1024)
 var gConnectionQueue = make(chan bool)
+var gSubscribed = make(chan struct{})
+var gSubscribedOnce sync.Once
+var gRetainedDone = make(chan struct{})
+var gRetainedDoneOnce sync.Once
+
+// Subscribed returns a channel that is closed once subscribed to all topics
+// for the first time, so retained messages are on their way
+func Subscribed() <-chan struct{} {
+	return gSubscribed
+}
+
+// StopReadingRetained unsubscribes from the retained state and info topics, once
+// they were read back, so our own publishes on them are not echoed back
+func StopReadingRetained() {
+	gRetainedDoneOnce.Do(func() { close(gRetainedDone) })
+}
+
 var gMqttTopics = []string{
 	// Note: Additional sub topics will be appended here upon Start
 }
+
+// gRetainedTopics are subscribed to as well, until StopReadingRetained
+var gRetainedTopics []string
@@ -33,6 +33,10 @@ func TestTopicBuildersAndExtractors(t *testing.T) {
 			t.Fatalf("topicSubDestinationConfig() = %q", got)
 		}
 
+		if got := topicSubDestinationSilence(); got != "mqtt2ping/silence/#" {
+			t.Fatalf("topicSubDestinationSilence() = %q", got)
+		}
+
 		if dest, ok := GetTopicSubDestinationStatus("mqtt2ping/status/router"); !ok || dest != "router" {
 			t.Fatalf("unexpected destination status parse: dest=%q ok=%t", dest, ok)
 		}
@@ -49,10 +53,102 @@ func TestTopicBuildersAndExtractors(t *testing.T) {
 			t.Fatalf("unexpected destination config parse: dest=%q ok=%t", dest, ok)
 		}
 
+		if _, ok := GetTopicSubDestinationConfig("mqtt2ping/destination/router/set"); ok {
+			t.Fatal("expected GetTopicSubDestinationConfig to reject partial update topic")
+		}
+
+		if dest, ok := GetTopicSubDestinationSet("mqtt2ping/destination/router/set"); !ok || dest != "router" {
+			t.Fatalf("unexpected destination set parse: dest=%q ok=%t", dest, ok)
+		}
+
+		if _, ok := GetTopicSubDestinationSet("mqtt2ping/destination/router"); ok {
+			t.Fatal("expected GetTopicSubDestinationSet to reject destination topic")
+		}
+
 		if _, ok := GetTopicSubDestinationConfig("mqtt2ping/destination"); ok {
 			t.Fatal("expected GetTopicSubDestinationConfig to reject incomplete topic")
 		}
 
+		if dest, ok := GetTopicSubDestinationSilence("mqtt2ping/silence/router"); !ok || dest != "router" {
+			t.Fatalf("unexpected destination silence parse: dest=%q ok=%t", dest, ok)
+		}
+
+		if topic := GetTopicSubSilence("mqtt2ping/destination/router"); topic != "" {
+			t.Fatalf("GetTopicSubSilence returned %q for a destination topic", topic)
+		}
+
+		if got := topicSubPing(); got != "mqtt2ping/ping/#" {
+			t.Fatalf("topicSubPing() = %q", got)
+		}
+
+		if id, ok := GetTopicSubPingId("mqtt2ping/ping/req1"); !ok || id != "req1" {
+			t.Fatalf("unexpected ping parse: id=%q ok=%t", id, ok)
+		}
+
+		if _, ok := GetTopicSubPingId("mqtt2ping/ping/req1/result"); ok {
+			t.Fatal("expected GetTopicSubPingId to reject result topic")
+		}
+
+		if topic := GetTopicSubPing("mqtt2ping/ping/req1/result"); topic != "mqtt2ping/ping/req1/result" {
+			t.Fatalf("GetTopicSubPing returned %q", topic)
+		}
+
+		if got := topicSubDestinationCommand(); got != "mqtt2ping/command/#" {
+			t.Fatalf("topicSubDestinationCommand() = %q", got)
+		}
+
+		if dest, ok := GetTopicSubDestinationCommand("mqtt2ping/command/router"); !ok || dest != "router" {
+			t.Fatalf("unexpected destination command parse: dest=%q ok=%t", dest, ok)
+		}
+
+		if got := topicSubDestinations(); got != "mqtt2ping/destinations" {
+			t.Fatalf("topicSubDestinations() = %q", got)
+		}
+
+		if topic := GetTopicSubDestinations("mqtt2ping/destinations/summary"); topic != "" {
+			t.Fatalf("GetTopicSubDestinations returned %q for the summary topic", topic)
+		}
+
+		if got := topicSubSettings(); got != "mqtt2ping/settings" {
+			t.Fatalf("topicSubSettings() = %q", got)
+		}
+
+		if topic := GetTopicSubSettings("mqtt2ping/settings/effective"); topic != "" {
+			t.Fatalf("GetTopicSubSettings returned %q for the effective topic", topic)
+		}
+
+		if got := topicSubExport(); got != "mqtt2ping/export" {
+			t.Fatalf("topicSubExport() = %q", got)
+		}
+
+		if topic := GetTopicSubImport("mqtt2ping/import"); topic != "mqtt2ping/import" {
+			t.Fatalf("GetTopicSubImport returned %q", topic)
+		}
+
+		if topic := GetTopicSubExport("mqtt2ping/snapshot"); topic != "" {
+			t.Fatalf("GetTopicSubExport returned %q for the snapshot topic", topic)
+		}
+
+		if got := topicSubAdvState(); got != "mqtt2ping/state/#" {
+			t.Fatalf("topicSubAdvState() = %q", got)
+		}
+
+		if got := topicSubAdvInfo(); got != "mqtt2ping/info/#" {
+			t.Fatalf("topicSubAdvInfo() = %q", got)
+		}
+
+		if dest, ok := GetTopicSubDestinationAdvState("mqtt2ping/state/router"); !ok || dest != "router" {
+			t.Fatalf("unexpected state parse: dest=%q ok=%t", dest, ok)
+		}
+
+		if dest, ok := GetTopicSubDestinationAdvInfo("mqtt2ping/info/router"); !ok || dest != "router" {
+			t.Fatalf("unexpected info parse: dest=%q ok=%t", dest, ok)
+		}
+
+		if topic := GetTopicSubAdvState("mqtt2ping/info/router"); topic != "" {
+			t.Fatalf("GetTopicSubAdvState returned %q for an info topic", topic)
+		}
+
 		if topic := GetTopicSubStatus("mqtt2ping/status/router"); topic != "mqtt2ping/status/router" {
 			t.Fatalf("GetTopicSubStatus returned %q", topic)
 		}
@@ -75,9 +171,69 @@ func TestAdvertiseHelpers(t *testing.T) {
 			t.Fatalf("unexpected adv state offline: %q %q", topic, payload)
 		}
 
+		topic, payload = MsgPubAdvStateValue("sensor1", StateUnreachable)
+		if topic != "mqtt2ping/state/sensor1" || payload != "unreachable" {
+			t.Fatalf("unexpected adv state unreachable: %q %q", topic, payload)
+		}
+
 		topic, payload = MsgPubAdvInfo("sensor1", "pong")
 		if topic != "mqtt2ping/info/sensor1" || payload != "pong" {
 			t.Fatalf("unexpected adv info: %q %q", topic, payload)
 		}
+
+		topic, payload = MsgPubPingResult("req1", "{}")
+		if topic != "mqtt2ping/ping/req1/result" || payload != "{}" {
+			t.Fatalf("unexpected ping result: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubDestinationsSummary("{}")
+		if topic != "mqtt2ping/destinations/summary" || payload != "{}" {
+			t.Fatalf("unexpected destinations summary: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubOutage("{}")
+		if topic != "mqtt2ping/outage" || payload != "{}" {
+			t.Fatalf("unexpected outage: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubConfig("sensor1", "{}")
+		if topic != "mqtt2ping/config/sensor1" || payload != "{}" {
+			t.Fatalf("unexpected config: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubDestinationConfig("sensor1", "")
+		if topic != "mqtt2ping/destination/sensor1" || payload != "" {
+			t.Fatalf("unexpected destination config: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubResult("sensor1", "{}")
+		if topic != "mqtt2ping/result/sensor1" || payload != "{}" {
+			t.Fatalf("unexpected result: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubSchema("{}")
+		if topic != "mqtt2ping/schema/destination" || payload != "{}" {
+			t.Fatalf("unexpected schema: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubSnapshot("{}")
+		if topic != "mqtt2ping/snapshot" || payload != "{}" {
+			t.Fatalf("unexpected snapshot: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubInventory("{}")
+		if topic != "mqtt2ping/inventory" || payload != "{}" {
+			t.Fatalf("unexpected inventory: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubSettingsEffective("{}")
+		if topic != "mqtt2ping/settings/effective" || payload != "{}" {
+			t.Fatalf("unexpected effective settings: %q %q", topic, payload)
+		}
+
+		topic, payload = MsgPubReload("{}")
+		if topic != "mqtt2ping/reload" || payload != "{}" {
+			t.Fatalf("unexpected reload: %q %q", topic, payload)
+		}
 	})
 }